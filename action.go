@@ -131,6 +131,10 @@ func DoRequest(gctx context.Context, s *Session, request *Request) (err error) {
 		// }
 		actionTimeout = actUnit.Timeout
 	}
+	if request.NonRespond {
+		// 无需响应的请求不随客户端断开而取消
+		gctx = context.WithoutCancel(gctx)
+	}
 	ctx := NewPlayContext(gctx, s, request, actionTimeout)
 	ctx.ActionRequest.ActionExist = actionExist
 
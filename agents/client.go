@@ -0,0 +1,95 @@
+package agents
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// ClientConfig 服务级的 HTTP 客户端设置, 零值字段使用 Agent 的默认值
+type ClientConfig struct {
+	Timeout         time.Duration // 整个请求的超时, 包括读取响应体
+	DialTimeout     time.Duration // 建立连接超时, 默认3s
+	IdleConnTimeout time.Duration // 空闲连接关闭时间, 默认90s
+	MaxConnsPerHost int           // 每台服务器最大连接数, 仅 HTTP/1.1 Agent 有效, h2c 在单连接上多路复用
+	TlsConfig       *tls.Config   // 设置后使用 https, 双向认证时在其中设置客户端证书
+	Header          http.Header   // 每个请求附加的请求头
+}
+
+// NewTlsConfig caFile 用于校验服务端证书, 为空时使用系统根证书; certFile 与 keyFile 为双向认证的客户端证书, 可为空
+func NewTlsConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func (c ClientConfig) dialer() *net.Dialer {
+	if c.DialTimeout > 0 {
+		return &net.Dialer{Timeout: c.DialTimeout}
+	}
+	return &net.Dialer{Timeout: 3 * time.Second}
+}
+
+func (c ClientConfig) idleConnTimeout() time.Duration {
+	if c.IdleConnTimeout > 0 {
+		return c.IdleConnTimeout
+	}
+	return 90 * time.Second
+}
+
+// newHttpClient HTTP/1.1 客户端, 服务端支持时 https 会协商为 HTTP/2
+func newHttpClient(c ClientConfig) *http.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         c.dialer().DialContext,
+		TLSClientConfig:     c.TlsConfig,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: max(c.MaxConnsPerHost, 16),
+		MaxConnsPerHost:     c.MaxConnsPerHost,
+		IdleConnTimeout:     c.idleConnTimeout(),
+	}
+	return &http.Client{Transport: transport, Timeout: c.Timeout}
+}
+
+// newH2cClient HTTP/2 客户端, 未设置 TlsConfig 时使用明文 h2c
+func newH2cClient(c ClientConfig) *http.Client {
+	dialer := c.dialer()
+	transport := &http2.Transport{IdleConnTimeout: c.idleConnTimeout()}
+	if c.TlsConfig == nil {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	} else {
+		transport.TLSClientConfig = c.TlsConfig
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			d := tls.Dialer{NetDialer: dialer, Config: cfg}
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: c.Timeout}
+}
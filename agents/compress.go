@@ -0,0 +1,30 @@
+package agents
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/leochen2038/play/codec/compressors"
+)
+
+// setAcceptEncoding 声明可解压的算法, 手动设置后 http.Transport 不再自动解压 gzip, 由 readResponseBody 负责
+func setAcceptEncoding(req *http.Request) {
+	req.Header.Set("Accept-Encoding", compressors.AcceptEncoding())
+}
+
+// readResponseBody 读取响应体, 按 Content-Encoding 解压, 不支持的编码返回错误而非原样返回压缩数据
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		c := compressors.Get(encoding)
+		if c == nil {
+			return nil, errors.New("unsupported content encoding:" + encoding)
+		}
+		return c.Decompress(data)
+	}
+	return data, nil
+}
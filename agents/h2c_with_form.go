@@ -4,62 +4,45 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"net"
-	"net/http"
 	"reflect"
-	"strings"
+	"sync"
 	"time"
 
-	"golang.org/x/net/http2"
-
+	"github.com/leochen2038/play"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 )
 
-var H2cWithForm = &h2cWithForm{router: make(map[string]string)}
+var H2cWithForm = &h2cWithForm{router: newHostRouter(newH2cClient, ClientConfig{Timeout: 30 * time.Second})}
 
 type h2cWithForm struct {
-	router map[string]string
+	router *hostRouter
 }
 
 func (a *h2cWithForm) SetRouter(servie string, host string) {
-	if !strings.Contains(host, "http") {
-		host = "http://" + host
-	}
-	a.router[servie] = host
+	a.router.set(servie, map[string]int{host: 1}, nil)
 }
 
-func (a *h2cWithForm) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
-	var err error
-	var host string
-	var resp *http.Response
-	if host = a.router[service]; host == "" {
-		return nil, errors.New("service:" + service + " router not found")
-	}
-
-	url := host + "/" + strings.ReplaceAll(action, ".", "/")
-
-	req, err := http.NewRequestWithContext(context.Background(), "post", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
+// SetRouterHosts 设置服务的多台服务器及权重, balancer 为 nil 时沿用已有策略, 默认平滑加权轮询
+func (a *h2cWithForm) SetRouterHosts(service string, hosts map[string]int, balancer play.Balancer) {
+	a.router.set(service, hosts, balancer)
+}
 
-	req.Header.Set("Content-Type", "multipart/form-data; boundary="+getBoundary())
-	client := getClient()
-	if resp, err = client.Do(req); err != nil {
-		return nil, err
-	}
+// SetServiceConfig 设置服务的超时、TLS、连接数与请求头, 未设置的服务使用默认客户端
+func (a *h2cWithForm) SetServiceConfig(service string, config ClientConfig) {
+	a.router.setConfig(service, config)
+}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("http status error:" + resp.Status)
-	}
+// RemoveRouter 移除服务的服务器与客户端设置
+func (a *h2cWithForm) RemoveRouter(service string) {
+	a.router.remove(service)
+}
 
-	return io.ReadAll(resp.Body)
+func (a *h2cWithForm) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
+	return a.router.post(ctx, service, action, "multipart/form-data; boundary="+getBoundary(), body)
 }
 
 func (a *h2cWithForm) Marshal(ctx context.Context, service string, action string, i interface{}) ([]byte, error) {
@@ -117,36 +100,16 @@ func (a *h2cWithForm) Unmarshal(ctx context.Context, service string, action stri
 	return json.Unmarshal(data, i)
 }
 
-var _client *http.Client
-
-func getClient() *http.Client {
-	if _client != nil {
-		return _client
-	}
-
-	transport := &http2.Transport{
-		AllowHTTP: true,
-		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-			return net.Dial(network, addr)
-		},
-	}
-
-	_client = &http.Client{Transport: transport, Timeout: 30 * time.Second}
-	return _client
-}
-
 var _boundary string
+var _boundaryOnce sync.Once
 
 func getBoundary() string {
-	if _boundary != "" {
-		return _boundary
-	}
-
-	var buf [30]byte
-	_, err := io.ReadFull(rand.Reader, buf[:])
-	if err != nil {
-		panic(err)
-	}
-	_boundary = fmt.Sprintf("%x", buf[:])
+	_boundaryOnce.Do(func() {
+		var buf [30]byte
+		if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+			panic(err)
+		}
+		_boundary = fmt.Sprintf("%x", buf[:])
+	})
 	return _boundary
 }
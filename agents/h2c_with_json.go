@@ -1,57 +1,40 @@
 package agents
 
 import (
-	"bytes"
 	"context"
-	"errors"
-	"io"
-	"net/http"
-	"strings"
+	"time"
 
+	"github.com/leochen2038/play"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 )
 
-var H2cWithJson = &h2cWithJson{router: make(map[string]string)}
+var H2cWithJson = &h2cWithJson{router: newHostRouter(newH2cClient, ClientConfig{Timeout: 30 * time.Second})}
 
 type h2cWithJson struct {
-	router map[string]string
+	router *hostRouter
 }
 
 func (a *h2cWithJson) SetRouter(servie string, host string) {
-	if !strings.Contains(host, "http") {
-		host = "http://" + host
-	}
-	a.router[servie] = host
+	a.router.set(servie, map[string]int{host: 1}, nil)
 }
 
-func (a *h2cWithJson) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
-	var err error
-	var host string
-	var resp *http.Response
-	if host = a.router[service]; host == "" {
-		return nil, errors.New("service:" + service + " router not found")
-	}
-
-	url := host + "/" + strings.ReplaceAll(action, ".", "/")
-
-	req, err := http.NewRequestWithContext(ctx, "post", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
+// SetRouterHosts 设置服务的多台服务器及权重, balancer 为 nil 时沿用已有策略, 默认平滑加权轮询
+func (a *h2cWithJson) SetRouterHosts(service string, hosts map[string]int, balancer play.Balancer) {
+	a.router.set(service, hosts, balancer)
+}
 
-	client := getClient()
-	if resp, err = client.Do(req); err != nil {
-		return nil, err
-	}
+// SetServiceConfig 设置服务的超时、TLS、连接数与请求头, 未设置的服务使用默认客户端
+func (a *h2cWithJson) SetServiceConfig(service string, config ClientConfig) {
+	a.router.setConfig(service, config)
+}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("http status error:" + resp.Status)
-	}
+// RemoveRouter 移除服务的服务器与客户端设置
+func (a *h2cWithJson) RemoveRouter(service string) {
+	a.router.remove(service)
+}
 
-	return io.ReadAll(resp.Body)
+func (a *h2cWithJson) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
+	return a.router.post(ctx, service, action, "application/json", body)
 }
 
 func (a *h2cWithJson) Marshal(ctx context.Context, service string, action string, i interface{}) ([]byte, error) {
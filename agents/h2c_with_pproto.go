@@ -5,29 +5,39 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"io"
-	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/leochen2038/play/codec/protos/pproto"
-	"golang.org/x/net/http2"
 
 	"github.com/leochen2038/play/codec/protos/golang/json"
 )
 
 var h2cPProtoRoute sync.Map
-var h2cClient *http.Client
 
 type h2cPProtoAgent struct {
 	host   string
 	config map[string]interface{}
+	client *http.Client
 }
 
+// SetH2cPProtoRouter config 支持 timeout(time.Duration, 默认500ms)、tlsConfig(*tls.Config)、header(http.Header), 每个服务使用独立的客户端
 func SetH2cPProtoRouter(name string, host string, config map[string]interface{}) {
-	h2cPProtoRoute.Store(name, &h2cPProtoAgent{host: host, config: config})
+	var c = ClientConfig{Timeout: 500 * time.Millisecond}
+	if t, ok := config["timeout"].(time.Duration); ok {
+		c.Timeout = t
+	}
+	if t, ok := config["tlsConfig"].(*tls.Config); ok {
+		c.TlsConfig = t
+	}
+	if h, ok := config["header"].(http.Header); ok {
+		c.Header = h
+	}
+	if old, ok := h2cPProtoRoute.Swap(name, &h2cPProtoAgent{host: host, config: config, client: newH2cClient(c)}); ok {
+		old.(*h2cPProtoAgent).client.CloseIdleConnections()
+	}
 }
 
 func GetH2cPProtoAgent(name string) (*h2cPProtoAgent, error) {
@@ -38,26 +48,6 @@ func GetH2cPProtoAgent(name string) (*h2cPProtoAgent, error) {
 	}
 }
 
-func getH2cClient(config map[string]interface{}) *http.Client {
-	if h2cClient != nil {
-		return h2cClient
-	}
-	transport := &http2.Transport{
-		AllowHTTP: true,
-		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-			return net.Dial(network, addr)
-		},
-	}
-
-	var timeout = 500 * time.Millisecond
-	if t, ok := config["timeout"]; ok {
-		timeout = t.(time.Duration)
-	}
-	h2cClient = &http.Client{Transport: transport, Timeout: timeout}
-
-	return h2cClient
-}
-
 func (a *h2cPProtoAgent) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
 	var err error
 	var resp *http.Response
@@ -69,8 +59,13 @@ func (a *h2cPProtoAgent) Request(ctx context.Context, service string, action str
 		return nil, err
 	}
 
-	client := getH2cClient(a.config)
-	if resp, err = client.Do(req); err != nil {
+	if h, ok := a.config["header"].(http.Header); ok {
+		for k, v := range h {
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+	setAcceptEncoding(req)
+	if resp, err = a.client.Do(req); err != nil {
 		return nil, err
 	}
 
@@ -79,7 +74,7 @@ func (a *h2cPProtoAgent) Request(ctx context.Context, service string, action str
 		return nil, errors.New("http status error:" + resp.Status)
 	}
 
-	return io.ReadAll(resp.Body)
+	return readResponseBody(resp)
 }
 
 func (a *h2cPProtoAgent) Marshal(ctx context.Context, service string, action string, i interface{}) ([]byte, error) {
@@ -1,51 +1,39 @@
 package agents
 
 import (
-	"bytes"
 	"context"
-	"errors"
-	"io"
-	"net/http"
-	"strings"
 
+	"github.com/leochen2038/play"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 )
 
-var HttpWithJson = &httpWithJson{router: make(map[string]string)}
+var HttpWithJson = &httpWithJson{router: newHostRouter(newHttpClient, ClientConfig{})}
 
 type httpWithJson struct {
-	router map[string]string
+	router *hostRouter
 }
 
 func (a *httpWithJson) SetRouter(servie string, host string) {
-	a.router[servie] = host
+	a.router.set(servie, map[string]int{host: 1}, nil)
 }
 
-func (a *httpWithJson) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
-	var err error
-	var host string
-	var resp *http.Response
-	if host = a.router[service]; host == "" {
-		return nil, errors.New("service:" + service + " router not found")
-	}
-
-	url := host + "/" + strings.ReplaceAll(action, ".", "/")
+// SetRouterHosts 设置服务的多台服务器及权重, balancer 为 nil 时沿用已有策略, 默认平滑加权轮询
+func (a *httpWithJson) SetRouterHosts(service string, hosts map[string]int, balancer play.Balancer) {
+	a.router.set(service, hosts, balancer)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "post", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, err
-	}
+// SetServiceConfig 设置服务的超时、TLS、连接数与请求头, 未设置的服务使用默认客户端
+func (a *httpWithJson) SetServiceConfig(service string, config ClientConfig) {
+	a.router.setConfig(service, config)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	if resp, err = (&http.Client{}).Do(req); err != nil {
-		return nil, err
-	}
+// RemoveRouter 移除服务的服务器与客户端设置
+func (a *httpWithJson) RemoveRouter(service string) {
+	a.router.remove(service)
+}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("http status error:" + resp.Status)
-	}
-	return io.ReadAll(resp.Body)
+func (a *httpWithJson) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
+	return a.router.post(ctx, service, action, "application/json", body)
 }
 
 func (a *httpWithJson) Marshal(ctx context.Context, service string, action string, i interface{}) ([]byte, error) {
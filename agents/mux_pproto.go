@@ -0,0 +1,381 @@
+package agents
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+	"github.com/leochen2038/play/codec/protos/pproto"
+	"github.com/quic-go/quic-go"
+)
+
+var muxPProtoRoute sync.Map
+
+var errMuxConnClosed = errors.New("mux pproto connection closed")
+
+// muxPProtoAgent 在少量长连接上并发发送 pproto v5 请求, 通过帧头中的 requestId 关联响应
+type muxPProtoAgent struct {
+	network      string // tcp 或 quic
+	addr         string
+	tlsConfig    *tls.Config
+	quicConfig   *quic.Config
+	requestId    atomic.Uint64
+	next         atomic.Uint32
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	mu           sync.Mutex
+	conns        []*muxConn
+	dialing      []*muxDial
+}
+
+// muxDial 同一位置上进行中的建连, 并发请求共用其结果
+type muxDial struct {
+	done chan struct{}
+	conn *muxConn
+	err  error
+}
+
+type muxTransport interface {
+	io.ReadWriteCloser
+	SetWriteDeadline(t time.Time) error
+}
+
+type muxResult struct {
+	data []byte
+	err  error
+}
+
+type muxConn struct {
+	transport    muxTransport
+	writeTimeout time.Duration
+	writeMu      sync.Mutex
+	mu           sync.Mutex
+	pending      map[uint64]chan muxResult
+	err          error
+}
+
+// quicStreamTransport quic 连接上的一条长期双向流, 关闭时一并关闭连接
+type quicStreamTransport struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+func (t quicStreamTransport) Close() error {
+	t.Stream.CancelRead(0)
+	t.Stream.Close()
+	return t.conn.CloseWithError(0, "")
+}
+
+// NewMuxPProtoAgent network 为 tcp 或 quic, conns 为到 addr 的长连接数量, 默认1
+func NewMuxPProtoAgent(network string, addr string, conns int) *muxPProtoAgent {
+	if conns <= 0 {
+		conns = 1
+	}
+	return &muxPProtoAgent{network: network, addr: addr, dialTimeout: 10 * time.Second, writeTimeout: 10 * time.Second, conns: make([]*muxConn, conns), dialing: make([]*muxDial, conns)}
+}
+
+// WithDialTimeout 建立连接的超时, 默认10s; 建连不受单个请求 ctx 的影响
+func (a *muxPProtoAgent) WithDialTimeout(timeout time.Duration) *muxPProtoAgent {
+	a.dialTimeout = timeout
+	return a
+}
+
+// WithWriteTimeout 写出一帧的超时, 默认10s, 0:不限制; 超时后帧可能不完整, 连接断开, 其上等待中的请求返回错误
+// 写超时作用于连接而非单个请求, 请求的 ctx 只在写出前检查
+func (a *muxPProtoAgent) WithWriteTimeout(timeout time.Duration) *muxPProtoAgent {
+	a.writeTimeout = timeout
+	return a
+}
+
+// WithTlsConfig tcp 时使用 tls 连接; quic 未设置时不校验服务端证书, 使用 quicServer 协议
+func (a *muxPProtoAgent) WithTlsConfig(config *tls.Config) *muxPProtoAgent {
+	a.tlsConfig = config
+	return a
+}
+
+func (a *muxPProtoAgent) WithQuicConfig(config *quic.Config) *muxPProtoAgent {
+	a.quicConfig = config
+	return a
+}
+
+func SetMuxPProtoRouter(name string, agent *muxPProtoAgent) {
+	muxPProtoRoute.Store(name, agent)
+}
+
+func GetMuxPProtoAgent(name string) (*muxPProtoAgent, error) {
+	if agent, ok := muxPProtoRoute.Load(name); !ok {
+		return nil, errors.New("not found agent by:" + name)
+	} else {
+		return agent.(*muxPProtoAgent), nil
+	}
+}
+
+// Close 关闭所有连接, 等待中的请求返回错误
+func (a *muxPProtoAgent) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, c := range a.conns {
+		if c != nil {
+			c.fail(errMuxConnClosed)
+			a.conns[k] = nil
+		}
+	}
+}
+
+// Request body 为 Marshal 生成的 v5 请求帧, 发送时写入新分配的 requestId;
+// ctx 取消或超时时立即返回并向服务端发送取消帧, 迟到的响应被丢弃
+func (a *muxPProtoAgent) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
+	if len(body) < 32 || body[8] != 5 {
+		return nil, errors.New("mux pproto agent requires protocol v5 request")
+	}
+	c, err := a.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var frame = append([]byte(nil), body...)
+	var id = a.requestId.Add(1)
+	binary.LittleEndian.PutUint64(frame[9:17], id)
+
+	if body[17]&pproto.FlagNonRespond > 0 {
+		return nil, c.write(ctx, frame)
+	}
+
+	ch, err := c.register(id)
+	if err != nil {
+		return nil, err
+	}
+	defer c.unregister(id)
+	if err = c.write(ctx, frame); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res.data, res.err
+	case <-ctx.Done():
+		go c.cancel(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (a *muxPProtoAgent) Marshal(ctx context.Context, service string, action string, i interface{}) ([]byte, error) {
+	request, err := pproto.NewPlayProtocolRequest(ctx, callerId, action, i)
+	if err != nil {
+		return nil, err
+	}
+	request.Version = 5
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Header.Deadline = deadline
+	}
+	return pproto.MarshalProtocolRequest(request)
+}
+
+func (a *muxPProtoAgent) Unmarshal(ctx context.Context, service string, action string, data []byte, i interface{}) error {
+	if response, _, err := pproto.UnmarshalProtocolResponse(data); err != nil {
+		return err
+	} else {
+		return json.Unmarshal(response.Body, i)
+	}
+}
+
+// getConn 轮询选择连接, 断开的连接在下次使用时重连; 建连在锁外进行, 同一位置的并发请求等待同一次建连
+func (a *muxPProtoAgent) getConn(ctx context.Context) (*muxConn, error) {
+	idx := int(a.next.Add(1)) % len(a.conns)
+
+	a.mu.Lock()
+	if c := a.conns[idx]; c != nil && !c.broken() {
+		a.mu.Unlock()
+		return c, nil
+	}
+	d := a.dialing[idx]
+	if d == nil {
+		d = &muxDial{done: make(chan struct{})}
+		a.dialing[idx] = d
+		go a.connect(idx, d)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return d.conn, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *muxPProtoAgent) connect(idx int, d *muxDial) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.dialTimeout)
+	defer cancel()
+	transport, err := a.dial(ctx)
+
+	a.mu.Lock()
+	a.dialing[idx] = nil
+	if err != nil {
+		d.err = errors.New("connect to " + a.addr + " error:" + err.Error())
+	} else {
+		d.conn = &muxConn{transport: transport, writeTimeout: a.writeTimeout, pending: make(map[uint64]chan muxResult)}
+		a.conns[idx] = d.conn
+		go d.conn.readLoop()
+	}
+	a.mu.Unlock()
+	close(d.done)
+}
+
+func (a *muxPProtoAgent) dial(ctx context.Context) (muxTransport, error) {
+	if a.network == "quic" {
+		tlsConf := a.tlsConfig
+		if tlsConf == nil {
+			tlsConf = &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"quicServer"}}
+		}
+		conn, err := quic.DialAddr(ctx, a.addr, tlsConf, a.quicConfig)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			conn.CloseWithError(0, "")
+			return nil, err
+		}
+		return quicStreamTransport{Stream: stream, conn: conn}, nil
+	}
+
+	if a.tlsConfig != nil {
+		d := tls.Dialer{Config: a.tlsConfig}
+		conn, err := d.DialContext(ctx, "tcp", a.addr)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(*tls.Conn), nil
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", a.addr)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.TCPConn), nil
+}
+
+func (c *muxConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+func (c *muxConn) register(id uint64) (chan muxResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	ch := make(chan muxResult, 1)
+	c.pending[id] = ch
+	return ch, nil
+}
+
+func (c *muxConn) unregister(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// write 串行写出整帧, ctx 已结束时不再写出; 写超时或失败时帧可能不完整, 连接不再可用
+func (c *muxConn) write(ctx context.Context, frame []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		// 等待写锁期间 ctx 已结束, 帧尚未写出, 连接仍可用
+		return err
+	}
+
+	var deadline time.Time
+	if c.writeTimeout > 0 {
+		deadline = time.Now().Add(c.writeTimeout)
+	}
+	c.transport.SetWriteDeadline(deadline)
+	if _, err := c.transport.Write(frame); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// cancel 通知服务端取消请求, 尽力发送, 失败时不影响调用方
+func (c *muxConn) cancel(id uint64) {
+	if c.broken() {
+		return
+	}
+	frame, err := pproto.MarshalProtocolRequest(pproto.PlayProtocolRequest{Version: 5, RequestId: id, Flags: pproto.FlagCancel})
+	if err != nil {
+		return
+	}
+	_ = c.write(context.Background(), frame)
+}
+
+func (c *muxConn) readLoop() {
+	var buffer = make([]byte, 4096)
+	var surplus []byte
+	for {
+		n, err := c.transport.Read(buffer)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		surplus = append(surplus, buffer[:n]...)
+		for len(surplus) >= 17 {
+			if string(surplus[:4]) != "<<==" || surplus[8] != 5 {
+				c.fail(errors.New("mux pproto unexpected response frame"))
+				return
+			}
+			size := binary.LittleEndian.Uint32(surplus[4:8])
+			if size > pproto.MaxFrameSize {
+				c.fail(pproto.ErrFrameTooLarge)
+				return
+			}
+			if uint64(len(surplus)) < uint64(size)+8 {
+				break
+			}
+			frame := append([]byte(nil), surplus[:size+8]...)
+			surplus = surplus[size+8:]
+			c.deliver(binary.LittleEndian.Uint64(frame[9:17]), frame)
+		}
+	}
+}
+
+func (c *muxConn) deliver(id uint64, frame []byte) {
+	c.mu.Lock()
+	ch := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ch != nil {
+		ch <- muxResult{data: frame}
+	}
+}
+
+// fail 关闭连接并通知所有等待中的请求
+func (c *muxConn) fail(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	c.transport.Close()
+	for _, ch := range pending {
+		ch <- muxResult{err: err}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 
+	"github.com/leochen2038/play/codec/compressors"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 	"github.com/leochen2038/play/codec/protos/pproto"
 )
@@ -53,10 +54,9 @@ func (a *PlaySocket) Marshal(ctx context.Context, service string, action string,
 	if body, err = json.Marshal(i); err != nil {
 		return nil, err
 	}
-	return pproto.MarshalProtocolRequest(pproto.PlayProtocolRequest{
-		Action: action,
-		Body:   body,
-	})
+	request := pproto.PlayProtocolRequest{Action: action, Body: body}
+	request.Header.AcceptEncoding = compressors.AcceptEncoding()
+	return pproto.MarshalProtocolRequest(request)
 }
 
 func (a *PlaySocket) Unmarshal(ctx context.Context, service string, action string, data []byte, i interface{}) error {
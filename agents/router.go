@@ -0,0 +1,138 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/leochen2038/play"
+)
+
+// hostRouter 服务名到服务器组及客户端设置的映射, 每次请求按服务器组的负载均衡策略选择服务器, 可在运行中并发更新
+type hostRouter struct {
+	mu            sync.RWMutex
+	services      map[string]*routeService
+	newClient     func(config ClientConfig) *http.Client
+	defaultConfig ClientConfig
+	defaultClient *http.Client
+}
+
+type routeService struct {
+	group  *play.HostGroup
+	config ClientConfig
+	client *http.Client
+}
+
+func newHostRouter(newClient func(config ClientConfig) *http.Client, defaultConfig ClientConfig) *hostRouter {
+	return &hostRouter{
+		services:      make(map[string]*routeService),
+		newClient:     newClient,
+		defaultConfig: defaultConfig,
+		defaultClient: newClient(defaultConfig),
+	}
+}
+
+func (r *hostRouter) service(service string) *routeService {
+	s := r.services[service]
+	if s == nil {
+		s = &routeService{config: r.defaultConfig, client: r.defaultClient}
+		r.services[service] = s
+	}
+	return s
+}
+
+func (r *hostRouter) set(service string, hosts map[string]int, balancer play.Balancer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.service(service)
+	if s.group == nil || balancer != nil {
+		s.group = play.NewHostGroup(balancer)
+	}
+	s.group.Set(hosts)
+}
+
+// setConfig 替换服务的客户端, 旧客户端上进行中的请求不受影响
+func (r *hostRouter) setConfig(service string, config ClientConfig) {
+	if config.Timeout == 0 {
+		config.Timeout = r.defaultConfig.Timeout
+	}
+	client := r.newClient(config)
+
+	r.mu.Lock()
+	s := r.service(service)
+	old := s.client
+	s.config, s.client = config, client
+	r.mu.Unlock()
+
+	if old != r.defaultClient {
+		old.CloseIdleConnections()
+	}
+}
+
+func (r *hostRouter) remove(service string) {
+	r.mu.Lock()
+	s := r.services[service]
+	delete(r.services, service)
+	r.mu.Unlock()
+
+	if s != nil && s.client != r.defaultClient {
+		s.client.CloseIdleConnections()
+	}
+}
+
+// post 选择服务器发送 POST 请求, 返回解压后的响应体
+func (r *hostRouter) post(ctx context.Context, service string, action string, contentType string, body []byte) ([]byte, error) {
+	r.mu.RLock()
+	s := r.services[service]
+	var group *play.HostGroup
+	var config ClientConfig
+	var client *http.Client
+	if s != nil {
+		group, config, client = s.group, s.config, s.client
+	}
+	r.mu.RUnlock()
+
+	if group == nil {
+		return nil, errors.New("service:" + service + " router not found")
+	}
+	h, err := group.Pick(ctx)
+	if err != nil {
+		return nil, errors.New("service:" + service + " " + err.Error())
+	}
+	h.Acquire()
+	defer h.Release()
+
+	url := h.Host
+	if !strings.Contains(url, "://") {
+		if config.TlsConfig != nil {
+			url = "https://" + url
+		} else {
+			url = "http://" + url
+		}
+	}
+	url += "/" + strings.ReplaceAll(action, ".", "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range config.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Header.Set("Content-Type", contentType)
+	setAcceptEncoding(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("http status error:" + resp.Status)
+	}
+	return readResponseBody(resp)
+}
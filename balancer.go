@@ -0,0 +1,398 @@
+package play
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNoAvailableHost = errors.New("no available host")
+
+// Balancer 负载均衡策略, Pick 由调用方加锁后调用, hosts 非空
+type Balancer interface {
+	Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost
+}
+
+// BalancerRemover 保存服务器状态的策略实现该接口, 服务器被删除时由调用方加锁后调用以释放其状态;
+// 被摘除或过滤掉的服务器只是暂时不出现在 hosts 中, 不会调用 Remove
+type BalancerRemover interface {
+	Remove(host *BalanceHost)
+}
+
+func removeBalanceHost(b Balancer, host *BalanceHost) {
+	if r, ok := b.(BalancerRemover); ok {
+		r.Remove(host)
+	}
+}
+
+// BalanceHost 参与负载均衡的服务器
+type BalanceHost struct {
+	Host       string
+	Weight     int
+	TagId      int // 0 表示不限定 tag
+	configured int // 配置的权重, 摘除恢复期间 Weight 小于该值; 0 表示与 Weight 相同
+	current    int
+	inflight   atomic.Int64
+}
+
+// BalanceKey 一次请求的路由依据, Key 用于一致性哈希, TagId 用于按 tag 路由
+type BalanceKey struct {
+	Key   string
+	TagId int
+}
+
+type balanceKeyCtx struct{}
+type balanceTagCtx struct{}
+
+// WithBalanceKey 设置一致性哈希使用的请求 key
+func WithBalanceKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, balanceKeyCtx{}, key)
+}
+
+// BalanceKeyOf 从 ctx 中取出路由依据, TagId 取自 play.Context 的 Trace.TagId
+func BalanceKeyOf(ctx context.Context) (key BalanceKey) {
+	if ctx == nil {
+		return
+	}
+	key.Key, _ = ctx.Value(balanceKeyCtx{}).(string)
+	key.TagId, _ = ctx.Value(balanceTagCtx{}).(int)
+	return
+}
+
+// configuredWeight 一致性哈希按配置的权重分配虚拟节点, 恢复期间权重变化不影响 key 的归属
+func (h *BalanceHost) configuredWeight() int {
+	if h.configured > 0 {
+		return h.configured
+	}
+	return h.Weight
+}
+
+// Inflight 返回正在处理中的请求数
+func (h *BalanceHost) Inflight() int64 {
+	return h.inflight.Load()
+}
+
+// Acquire 开始一次请求, 完成后需调用 Release
+func (h *BalanceHost) Acquire() {
+	h.inflight.Add(1)
+}
+
+func (h *BalanceHost) Release() {
+	h.inflight.Add(-1)
+}
+
+// HostGroup 一组服务器及其负载均衡策略, 可并发使用
+type HostGroup struct {
+	mu       sync.Mutex
+	hosts    []*BalanceHost
+	balancer Balancer
+}
+
+// NewHostGroup balancer 为 nil 时使用平滑加权轮询
+func NewHostGroup(balancer Balancer) *HostGroup {
+	if balancer == nil {
+		balancer = NewRoundRobinBalancer()
+	}
+	return &HostGroup{balancer: balancer}
+}
+
+// Set 替换全部服务器, 保留已存在服务器的 tag 与请求计数
+func (g *HostGroup) Set(hosts map[string]int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var old = make(map[string]*BalanceHost, len(g.hosts))
+	for _, h := range g.hosts {
+		old[h.Host] = h
+	}
+	g.hosts = g.hosts[:0:0]
+	for host, h := range old {
+		if _, ok := hosts[host]; !ok {
+			removeBalanceHost(g.balancer, h)
+		}
+	}
+	for host, weight := range hosts {
+		if h := old[host]; h != nil {
+			h.Weight = weight
+			g.hosts = append(g.hosts, h)
+		} else {
+			g.hosts = append(g.hosts, &BalanceHost{Host: host, Weight: weight})
+		}
+	}
+	sort.Slice(g.hosts, func(i, j int) bool { return g.hosts[i].Host < g.hosts[j].Host })
+}
+
+// SetHost 添加服务器或修改权重
+func (g *HostGroup) SetHost(host string, weight int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if h := g.find(host); h != nil {
+		h.Weight = weight
+		return
+	}
+	g.hosts = append(g.hosts, &BalanceHost{Host: host, Weight: weight})
+	sort.Slice(g.hosts, func(i, j int) bool { return g.hosts[i].Host < g.hosts[j].Host })
+}
+
+// SetTag 设置服务器的 tag, 配合 NewTagBalancer 使用
+func (g *HostGroup) SetTag(host string, tagId int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if h := g.find(host); h != nil {
+		h.TagId = tagId
+	}
+}
+
+func (g *HostGroup) Delete(host string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for k, h := range g.hosts {
+		if h.Host == host {
+			g.hosts = append(g.hosts[:k:k], g.hosts[k+1:]...)
+			removeBalanceHost(g.balancer, h)
+			return
+		}
+	}
+}
+
+// Hosts 返回服务器及权重
+func (g *HostGroup) Hosts() map[string]int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	hosts := make(map[string]int, len(g.hosts))
+	for _, h := range g.hosts {
+		hosts[h.Host] = h.Weight
+	}
+	return hosts
+}
+
+// Pick 按策略选择服务器, 权重不大于0的服务器不参与选择
+func (g *HostGroup) Pick(ctx context.Context) (*BalanceHost, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var hosts = make([]*BalanceHost, 0, len(g.hosts))
+	for _, h := range g.hosts {
+		if h.Weight > 0 {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, ErrNoAvailableHost
+	}
+
+	return pickUntried(ctx, g.balancer, hosts), nil
+}
+
+func (g *HostGroup) find(host string) *BalanceHost {
+	for _, h := range g.hosts {
+		if h.Host == host {
+			return h
+		}
+	}
+	return nil
+}
+
+type roundRobinBalancer struct{}
+
+// NewRoundRobinBalancer 平滑加权轮询
+func NewRoundRobinBalancer() Balancer {
+	return roundRobinBalancer{}
+}
+
+func (roundRobinBalancer) Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost {
+	var total int
+	var best *BalanceHost
+	for _, h := range hosts {
+		total += h.Weight
+		h.current += h.Weight
+		if best == nil || h.current > best.current {
+			best = h
+		}
+	}
+	best.current -= total
+	return best
+}
+
+type consistentHashBalancer struct {
+	replicas int
+	members  map[*BalanceHost]int
+	ring     []uint32
+	owners   []*BalanceHost
+	fallback Balancer
+}
+
+// NewConsistentHashBalancer 按 BalanceKey.Key 做一致性哈希, 每单位配置权重对应 replicas 个虚拟节点;
+// 被摘除或过滤掉的服务器在查找时跳过, 其 key 落到环上的下一台服务器, 其余 key 的归属不变; 未设置 key 时按加权轮询选择
+func NewConsistentHashBalancer(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = 40
+	}
+	return &consistentHashBalancer{replicas: replicas, fallback: NewRoundRobinBalancer()}
+}
+
+func (b *consistentHashBalancer) Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost {
+	if key.Key == "" {
+		return b.fallback.Pick(hosts, key)
+	}
+	b.build(hosts)
+
+	// hosts 与环上成员相同时无需跳过
+	var available map[*BalanceHost]bool
+	if len(hosts) < len(b.members) {
+		available = make(map[*BalanceHost]bool, len(hosts))
+		for _, h := range hosts {
+			available[h] = true
+		}
+	}
+	hash := crc32.ChecksumIEEE([]byte(key.Key))
+	idx := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= hash })
+	for i := 0; i < len(b.ring); i++ {
+		if owner := b.owners[(idx+i)%len(b.ring)]; available == nil || available[owner] {
+			return owner
+		}
+	}
+	return hosts[0]
+}
+
+// Remove 服务器被删除后从环上移除其虚拟节点, 下次 Pick 时重建
+func (b *consistentHashBalancer) Remove(host *BalanceHost) {
+	if _, ok := b.members[host]; ok {
+		delete(b.members, host)
+		b.ring, b.owners = nil, nil
+	}
+}
+
+// build 出现新的服务器或配置权重变化时重建哈希环; 虚拟节点只由服务器地址决定, 重建不改变其余 key 的归属
+func (b *consistentHashBalancer) build(hosts []*BalanceHost) {
+	var changed = len(b.ring) == 0
+	for _, h := range hosts {
+		if w, ok := b.members[h]; !ok || w != h.configuredWeight() {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	type node struct {
+		hash  uint32
+		owner *BalanceHost
+	}
+	var nodes []node
+	b.members = make(map[*BalanceHost]int, len(hosts))
+	for _, h := range hosts {
+		b.members[h] = h.configuredWeight()
+		for i := 0; i < h.configuredWeight()*b.replicas; i++ {
+			nodes = append(nodes, node{hash: crc32.ChecksumIEEE([]byte(h.Host + "#" + strconv.Itoa(i))), owner: h})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].hash != nodes[j].hash {
+			return nodes[i].hash < nodes[j].hash
+		}
+		return nodes[i].owner.Host < nodes[j].owner.Host
+	})
+	b.ring, b.owners = make([]uint32, len(nodes)), make([]*BalanceHost, len(nodes))
+	for k, n := range nodes {
+		b.ring[k], b.owners[k] = n.hash, n.owner
+	}
+}
+
+type leastInflightBalancer struct{}
+
+// NewLeastInflightBalancer 选择处理中请求数与权重之比最小的服务器
+func NewLeastInflightBalancer() Balancer {
+	return leastInflightBalancer{}
+}
+
+func (leastInflightBalancer) Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost {
+	var best *BalanceHost
+	for _, h := range hosts {
+		if best == nil || lessLoaded(h, best) {
+			best = h
+		}
+	}
+	return best
+}
+
+type p2cBalancer struct{}
+
+// NewP2CBalancer 按权重随机选出两台, 取处理中请求较少的一台
+func NewP2CBalancer() Balancer {
+	return p2cBalancer{}
+}
+
+func (p2cBalancer) Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost {
+	if len(hosts) == 1 {
+		return hosts[0]
+	}
+	a, b := weightedRandom(hosts), weightedRandom(hosts)
+	for i := 0; a == b && i < 3; i++ {
+		b = weightedRandom(hosts)
+	}
+	if lessLoaded(b, a) {
+		return b
+	}
+	return a
+}
+
+type tagBalancer struct {
+	next Balancer
+}
+
+// NewTagBalancer 优先选择 TagId 与请求相同的服务器, 没有时选择未设置 tag 的服务器, 都没有时在全部服务器中选择;
+// 选出的服务器交由 next 做负载均衡, next 为 nil 时使用加权轮询
+func NewTagBalancer(next Balancer) Balancer {
+	if next == nil {
+		next = NewRoundRobinBalancer()
+	}
+	return &tagBalancer{next: next}
+}
+
+func (b *tagBalancer) Remove(host *BalanceHost) {
+	removeBalanceHost(b.next, host)
+}
+
+func (b *tagBalancer) Pick(hosts []*BalanceHost, key BalanceKey) *BalanceHost {
+	var tagged, untagged []*BalanceHost
+	for _, h := range hosts {
+		if key.TagId != 0 && h.TagId == key.TagId {
+			tagged = append(tagged, h)
+		} else if h.TagId == 0 {
+			untagged = append(untagged, h)
+		}
+	}
+	if len(tagged) > 0 {
+		return b.next.Pick(tagged, key)
+	}
+	if len(untagged) > 0 {
+		return b.next.Pick(untagged, key)
+	}
+	return b.next.Pick(hosts, key)
+}
+
+func lessLoaded(a, b *BalanceHost) bool {
+	// a.inflight/a.weight < b.inflight/b.weight
+	return a.Inflight()*int64(b.Weight) < b.Inflight()*int64(a.Weight)
+}
+
+func weightedRandom(hosts []*BalanceHost) *BalanceHost {
+	var total int
+	for _, h := range hosts {
+		total += h.Weight
+	}
+	n := rand.IntN(total)
+	for _, h := range hosts {
+		if n -= h.Weight; n < 0 {
+			return h
+		}
+	}
+	return hosts[len(hosts)-1]
+}
@@ -0,0 +1,323 @@
+package play
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newBalanceHosts(weights ...int) []*BalanceHost {
+	hosts := make([]*BalanceHost, len(weights))
+	for k, w := range weights {
+		hosts[k] = &BalanceHost{Host: "10.0.0." + strconv.Itoa(k+1) + ":80", Weight: w}
+	}
+	return hosts
+}
+
+// pickKeys 返回每个 key 选中的服务器
+func pickKeys(b Balancer, hosts []*BalanceHost, n int) []string {
+	picked := make([]string, n)
+	for k := range picked {
+		picked[k] = b.Pick(hosts, BalanceKey{Key: "user-" + strconv.Itoa(k)}).Host
+	}
+	return picked
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		want    []int
+	}{
+		{name: "equal", weights: []int{1, 1, 1}, want: []int{100, 100, 100}},
+		{name: "weighted", weights: []int{5, 1, 2}, want: []int{200, 40, 80}},
+		{name: "single", weights: []int{3}, want: []int{300}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hosts := NewRoundRobinBalancer(), newBalanceHosts(tt.weights...)
+			var total int
+			for _, w := range tt.want {
+				total += w
+			}
+			count := make(map[string]int)
+			for i := 0; i < total; i++ {
+				count[b.Pick(hosts, BalanceKey{}).Host]++
+			}
+			for k, h := range hosts {
+				if count[h.Host] != tt.want[k] {
+					t.Fatalf("%s picked %d times, want %d", h.Host, count[h.Host], tt.want[k])
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	const keys = 1000
+	tests := []struct {
+		name string
+		// change 修改服务器列表, 返回新的列表及允许改变归属的服务器
+		change func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool)
+	}{
+		{name: "unchanged", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			return hosts, nil
+		}},
+		{name: "reordered", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			return []*BalanceHost{hosts[3], hosts[1], hosts[0], hosts[2]}, nil
+		}},
+		{name: "host removed", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			return []*BalanceHost{hosts[0], hosts[2], hosts[3]}, map[string]bool{hosts[1].Host: true}
+		}},
+		{name: "host ejected", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			// 摘除的服务器不出现在候选中, 但仍是环上的成员
+			return []*BalanceHost{hosts[0], hosts[1], hosts[3]}, map[string]bool{hosts[2].Host: true}
+		}},
+		{name: "ramp up", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			hosts[1].configured, hosts[1].Weight = hosts[1].Weight, 1
+			return hosts, nil
+		}},
+		{name: "host added", change: func(hosts []*BalanceHost) ([]*BalanceHost, map[string]bool) {
+			added := &BalanceHost{Host: "10.0.0.9:80", Weight: 2}
+			return append(hosts, added), map[string]bool{added.Host: true}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hosts := NewConsistentHashBalancer(0), newBalanceHosts(2, 2, 2, 2)
+			before := pickKeys(b, hosts, keys)
+			if again := pickKeys(b, hosts, keys); !equalStrings(before, again) {
+				t.Fatal("same key picked different hosts")
+			}
+
+			changed, moved := tt.change(hosts)
+			after := pickKeys(b, changed, keys)
+			for k := range before {
+				// 只有涉及的服务器上的 key 可以改变归属
+				if before[k] != after[k] && !moved[before[k]] && !moved[after[k]] {
+					t.Fatalf("key %d moved from %s to %s", k, before[k], after[k])
+				}
+				if !containsHost(changed, after[k]) {
+					t.Fatalf("key %d picked unavailable host %s", k, after[k])
+				}
+			}
+			// 服务器恢复后 key 回到原来的服务器
+			for _, h := range hosts {
+				h.configured = 0
+				h.Weight = 2
+			}
+			if restored := pickKeys(b, hosts, keys); !equalStrings(before, restored) {
+				t.Fatal("keys did not return after hosts restored")
+			}
+		})
+	}
+}
+
+func TestConsistentHashBalancerRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		tag    bool
+		remove func(g *HostGroup)
+		want   []string // 删除后剩余的服务器
+	}{
+		{name: "set", remove: func(g *HostGroup) {
+			g.Set(map[string]int{"10.0.0.1:80": 2, "10.0.0.3:80": 2})
+		}, want: []string{"10.0.0.1:80", "10.0.0.3:80"}},
+		{name: "delete", remove: func(g *HostGroup) {
+			g.Delete("10.0.0.2:80")
+		}, want: []string{"10.0.0.1:80", "10.0.0.3:80"}},
+		{name: "delete through tag balancer", tag: true, remove: func(g *HostGroup) {
+			g.Delete("10.0.0.3:80")
+		}, want: []string{"10.0.0.1:80", "10.0.0.2:80"}},
+		{name: "delete all but one", remove: func(g *HostGroup) {
+			g.Delete("10.0.0.1:80")
+			g.Delete("10.0.0.3:80")
+		}, want: []string{"10.0.0.2:80"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewConsistentHashBalancer(10).(*consistentHashBalancer)
+			g := NewHostGroup(b)
+			if tt.tag {
+				g = NewHostGroup(NewTagBalancer(b))
+			}
+			g.Set(map[string]int{"10.0.0.1:80": 2, "10.0.0.2:80": 2, "10.0.0.3:80": 2})
+			pick := func() map[string]string {
+				picked := make(map[string]string)
+				for k := 0; k < 300; k++ {
+					key := "user-" + strconv.Itoa(k)
+					h, err := g.Pick(WithBalanceKey(context.Background(), key))
+					if err != nil {
+						t.Fatal(err)
+					}
+					picked[key] = h.Host
+				}
+				return picked
+			}
+			before := pick()
+			tt.remove(g)
+			after := pick()
+
+			// 被删除的服务器不再留在环上
+			if len(b.members) != len(tt.want) || len(b.ring) != len(tt.want)*2*10 {
+				t.Fatalf("members = %d, ring = %d, want %d hosts", len(b.members), len(b.ring), len(tt.want))
+			}
+			for _, owner := range b.owners {
+				if g.find(owner.Host) != owner {
+					t.Fatalf("removed host %s still on ring", owner.Host)
+				}
+			}
+			// 剩余服务器上的 key 归属不变
+			for key, host := range before {
+				if g.find(host) != nil && after[key] != host {
+					t.Fatalf("key %s moved from %s to %s", key, host, after[key])
+				}
+			}
+		})
+	}
+}
+
+func TestConsistentHashBalancerWithoutKey(t *testing.T) {
+	b, hosts := NewConsistentHashBalancer(10), newBalanceHosts(1, 1)
+	count := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		count[b.Pick(hosts, BalanceKey{}).Host]++
+	}
+	if count[hosts[0].Host] != 5 || count[hosts[1].Host] != 5 {
+		t.Fatalf("picks without key = %v, want round robin", count)
+	}
+}
+
+func TestLoadAwareBalancers(t *testing.T) {
+	tests := []struct {
+		name     string
+		balancer Balancer
+		weights  []int
+		inflight []int64
+		want     int
+	}{
+		{name: "least inflight", balancer: NewLeastInflightBalancer(), weights: []int{1, 1, 1}, inflight: []int64{3, 1, 2}, want: 1},
+		{name: "least inflight by weight", balancer: NewLeastInflightBalancer(), weights: []int{4, 1}, inflight: []int64{3, 1}, want: 0},
+		{name: "p2c single", balancer: NewP2CBalancer(), weights: []int{1}, inflight: []int64{5}, want: 0},
+		{name: "p2c zero weight", balancer: NewP2CBalancer(), weights: []int{1, 0}, inflight: []int64{100, 0}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := newBalanceHosts(tt.weights...)
+			for k, n := range tt.inflight {
+				hosts[k].inflight.Store(n)
+			}
+			for i := 0; i < 20; i++ {
+				if h := tt.balancer.Pick(hosts, BalanceKey{}); h != hosts[tt.want] {
+					t.Fatalf("picked %s, want %s", h.Host, hosts[tt.want].Host)
+				}
+			}
+		})
+	}
+}
+
+func TestTagBalancer(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []int
+		tagId int
+		want  []int
+	}{
+		{name: "tagged", tags: []int{0, 7, 8}, tagId: 7, want: []int{1}},
+		{name: "fallback untagged", tags: []int{0, 7, 0}, tagId: 9, want: []int{0, 2}},
+		{name: "no tag", tags: []int{0, 7}, tagId: 0, want: []int{0}},
+		{name: "all tagged", tags: []int{7, 8}, tagId: 9, want: []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hosts := NewTagBalancer(nil), newBalanceHosts(make([]int, len(tt.tags))...)
+			for k, tag := range tt.tags {
+				hosts[k].Weight, hosts[k].TagId = 1, tag
+			}
+			picked := make(map[*BalanceHost]bool)
+			for i := 0; i < 10; i++ {
+				picked[b.Pick(hosts, BalanceKey{TagId: tt.tagId})] = true
+			}
+			if len(picked) != len(tt.want) {
+				t.Fatalf("picked %d hosts, want %d", len(picked), len(tt.want))
+			}
+			for _, k := range tt.want {
+				if !picked[hosts[k]] {
+					t.Fatalf("%s not picked", hosts[k].Host)
+				}
+			}
+		})
+	}
+}
+
+func TestSocketPoolEjection(t *testing.T) {
+	gs := NewGroupSocket(1).WithEjection(1, time.Minute).WithBalancer(func() Balancer { return NewConsistentHashBalancer(0) })
+	gs.SetGroup("g", map[string]int{"10.0.0.1:80": 2, "10.0.0.2:80": 2, "10.0.0.3:80": 2})
+	pool := gs.groups["g"]
+
+	pick := func() []string {
+		picked := make([]string, 300)
+		for k := range picked {
+			w, err := pool.next(WithBalanceKey(context.Background(), "user-"+strconv.Itoa(k)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			picked[k] = w.host
+		}
+		return picked
+	}
+
+	before := pick()
+	ejected := pool.hostsWeighted["10.0.0.2:80"]
+	ejected.markFail()
+	during := pick()
+	for k := range before {
+		if during[k] == ejected.host {
+			t.Fatalf("key %d picked ejected host", k)
+		}
+		if before[k] != ejected.host && during[k] != before[k] {
+			t.Fatalf("key %d moved from %s to %s while another host was ejected", k, before[k], during[k])
+		}
+	}
+
+	// 恢复期内权重逐步上升, key 的归属与摘除前一致
+	ejected.mu.Lock()
+	ejected.ejectedUntil = time.Now().Add(-time.Second)
+	ejected.mu.Unlock()
+	if w := ejected.effectiveWeight(time.Now()); w >= ejected.weight {
+		t.Fatalf("effective weight = %d, want ramping up", w)
+	}
+	if recovering := pick(); !equalStrings(before, recovering) {
+		t.Fatal("keys reshuffled during ramp up")
+	}
+
+	// 全部被摘除时忽略摘除状态
+	for _, w := range pool.hostsWeighted {
+		w.markFail()
+	}
+	if all := pick(); !equalStrings(before, all) {
+		t.Fatal("keys reshuffled when all hosts ejected")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsHost(hosts []*BalanceHost, host string) bool {
+	for _, h := range hosts {
+		if h.Host == host {
+			return true
+		}
+	}
+	return false
+}
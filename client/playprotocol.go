@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"net"
 	"unsafe"
+
+	"github.com/leochen2038/play/codec/compressors"
+	"github.com/leochen2038/play/codec/protos/pproto"
 )
 
 // request  protocol
@@ -32,16 +35,18 @@ import (
 // data
 
 type PlayProtocol struct {
-	Rc       int
-	Version  byte
-	CallerId int
-	TagId    int
-	TraceId  string
-	SpanId   []byte
-	Conn     net.Conn
-	Respond  byte
-	Action   string
-	Message  []byte
+	Rc         int
+	Version    byte
+	RequestId  uint64
+	CallerId   int
+	TagId      int
+	TraceId    string
+	SpanId     []byte
+	Conn       net.Conn
+	Respond    byte
+	Action     string
+	Message    []byte
+	Attachment map[string][]byte
 }
 
 func (p *PlayProtocol) ResponseByMessage(message []byte, rc int) error {
@@ -82,8 +87,19 @@ func (p *PlayProtocol) ResponseByMessage(message []byte, rc int) error {
 	}
 }
 
-func buildRequestBytes(version byte, tagId int, traceId string, spanId []byte, callerId int, action string, message []byte, respond bool) (buffer []byte, protocolSize int) {
-	if version == 3 {
+func buildRequestBytes(version byte, tagId int, traceId string, spanId []byte, callerId int, action string, message []byte, respond bool) (buffer []byte, protocolSize int, err error) {
+	if version >= 4 {
+		request := pproto.PlayProtocolRequest{Version: version, Action: action, NonRespond: !respond, Body: message}
+		request.Header.TagId = tagId
+		request.Header.TraceId = traceId
+		request.Header.SpanId = spanId
+		request.Header.CallerId = callerId
+		request.Header.AcceptEncoding = compressors.AcceptEncoding()
+		if buffer, err = pproto.MarshalProtocolRequest(request); err != nil {
+			return nil, 0, err
+		}
+		return buffer, len(buffer), nil
+	} else if version == 3 {
 		var actionLen = byte(len(action))
 		var responByte byte = 0
 
@@ -148,6 +164,9 @@ func parseResponseProtocol(buffer []byte) (*PlayProtocol, []byte, error) {
 		return nil, nil, err
 	}
 
+	if uint32(bytes2Int(buffer[4:8])) > pproto.MaxFrameSize {
+		return nil, nil, pproto.ErrFrameTooLarge
+	}
 	dataSize := bytes2Int(buffer[4:8]) + 8
 	if dataSize > len(buffer) {
 		// log.Printf("[playsocket server] error play socket protocol data length recv:%d, need:%d\n", len(buffer), dataLength)
@@ -155,11 +174,28 @@ func parseResponseProtocol(buffer []byte) (*PlayProtocol, []byte, error) {
 	}
 
 	// 检查协议标本号
-	if buffer[8] != 3 && buffer[8] != 2 {
-		err := fmt.Errorf("[play server] error play socket protocol version must be 2 or 3")
+	if buffer[8] < 2 || buffer[8] > 5 {
+		err := fmt.Errorf("[play server] error play socket protocol version must be 2, 3, 4 or 5")
 		return nil, nil, err
 	}
 
+	// v4/v5 的 body 可能被压缩, 由 pproto 负责解压
+	if buffer[8] >= 4 {
+		response, _, err := pproto.UnmarshalProtocolResponse(buffer[:dataSize])
+		if err != nil {
+			return nil, nil, err
+		}
+		return &PlayProtocol{
+			Rc:         response.ResultCode,
+			Version:    response.Version,
+			RequestId:  response.RequestId,
+			TagId:      response.Header.TagId,
+			TraceId:    response.Header.TraceId,
+			Message:    response.Body,
+			Attachment: response.Attachment,
+		}, buffer[dataSize:], nil
+	}
+
 	protocol := &PlayProtocol{}
 	protocol.Version = buffer[8]
 
@@ -29,7 +29,10 @@ func _connect(version byte, address string, callerId int, traceId string, spanId
 	if traceId == "" {
 		traceId = play.Generate28Id("trac", "")
 	}
-	requestByte, protocolSize := buildRequestBytes(version, tagId, traceId, spanId, callerId, action, message, respond)
+	requestByte, protocolSize, err := buildRequestBytes(version, tagId, traceId, spanId, callerId, action, message, respond)
+	if err != nil {
+		return nil, err
+	}
 
 	if n, err := conn.Write(requestByte); err != nil || n != protocolSize {
 		conn.Unsable = true
@@ -1,6 +1,7 @@
 package binders
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"mime/multipart"
@@ -24,9 +25,19 @@ type Binder interface {
 }
 
 type File struct {
-	Name string
-	Data []byte
-	Size int64
+	Name        string
+	Data        []byte
+	Size        int64
+	ContentType string
+	header      *multipart.FileHeader
+}
+
+// Open 读取上传文件内容, 流式上传时 Data 为空, 文件内容需通过 Open 读取
+func (f File) Open() (io.ReadCloser, error) {
+	if f.header != nil {
+		return f.header.Open()
+	}
+	return io.NopCloser(bytes.NewReader(f.Data)), nil
 }
 
 func parseSliceKey(k string, c string) (string, error) {
@@ -85,17 +96,23 @@ func setValWithString(vField reflect.Value, tField reflect.StructField, str stri
 	return nil
 }
 
-func setValWithFile(vField reflect.Value, fHeaders []*multipart.FileHeader) (err error) {
+func setValWithFile(vField reflect.Value, fHeaders []*multipart.FileHeader, stream bool) (err error) {
 	if len(fHeaders) == 0 {
 		return nil
 	}
 	fHeader := fHeaders[0]
 	var f multipart.File
 	file := File{
-		Name: fHeader.Filename,
-		Size: fHeader.Size,
-		Data: make([]byte, fHeader.Size),
+		Name:        fHeader.Filename,
+		Size:        fHeader.Size,
+		ContentType: fHeader.Header.Get("Content-Type"),
+		header:      fHeader,
+	}
+	if stream {
+		vField.Set(reflect.ValueOf(file))
+		return nil
 	}
+	file.Data = make([]byte, fHeader.Size)
 	if f, err = fHeader.Open(); err != nil {
 		return err
 	}
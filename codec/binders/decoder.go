@@ -0,0 +1,181 @@
+package binders
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// BodyDecoder 把请求体解码为binder, r 为原始请求, 可用于读取 Content-Type 参数或按路径选择消息类型
+type BodyDecoder func(body []byte, r *http.Request) (Binder, error)
+
+var (
+	decoderMu sync.RWMutex
+	decoders  = map[string]BodyDecoder{}
+)
+
+func init() {
+	RegisterBodyDecoder("application/json", decodeJson)
+	RegisterBodyDecoder("application/msgpack", decodeMsgpack)
+	RegisterBodyDecoder("application/x-msgpack", decodeMsgpack)
+	RegisterBodyDecoder("application/xml", decodeXml)
+	RegisterBodyDecoder("text/xml", decodeXml)
+	RegisterBodyDecoder("text/csv", decodeCsv)
+	RegisterBodyDecoder("application/x-protobuf", GetDecoderOfProtobuf(nil))
+	RegisterBodyDecoder("application/protobuf", GetDecoderOfProtobuf(nil))
+}
+
+// RegisterBodyDecoder 按媒体类型注册请求体解码器, 同名注册会覆盖已有的解码器
+func RegisterBodyDecoder(mediaType string, decoder BodyDecoder) {
+	decoderMu.Lock()
+	defer decoderMu.Unlock()
+	decoders[strings.ToLower(mediaType)] = decoder
+}
+
+// LookupBodyDecoder 按 Content-Type 查找解码器, 未注册返回nil
+func LookupBodyDecoder(contentType string) BodyDecoder {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	decoderMu.RLock()
+	defer decoderMu.RUnlock()
+	return decoders[mediaType]
+}
+
+// GetDecoderOfProtobuf resolve 为空时按 Content-Type 的 messageType 参数从全局注册表查找消息类型,
+// 如 application/x-protobuf; messageType=demo.UserRequest
+func GetDecoderOfProtobuf(resolve func(r *http.Request) protoreflect.MessageDescriptor) BodyDecoder {
+	return func(body []byte, r *http.Request) (Binder, error) {
+		var descriptor protoreflect.MessageDescriptor
+		if resolve != nil {
+			descriptor = resolve(r)
+		} else if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+			if mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(params["messagetype"])); err == nil {
+				descriptor = mt.Descriptor()
+			}
+		}
+		if descriptor == nil {
+			return nil, errors.New("protobuf message descriptor not found")
+		}
+		msg := dynamicpb.NewMessage(descriptor)
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return nil, err
+		}
+		return GetBinderOfProtobuf(msg.ProtoReflect()), nil
+	}
+}
+
+func decodeJson(body []byte, r *http.Request) (Binder, error) {
+	return GetBinderOfJson(body), nil
+}
+
+func decodeMsgpack(body []byte, r *http.Request) (Binder, error) {
+	var data map[string]any
+	if len(body) > 0 {
+		if err := msgpack.Unmarshal(body, &data); err != nil {
+			return nil, err
+		}
+	}
+	return GetBinderOfMap(data), nil
+}
+
+// decodeXml 根节点的子元素作为参数, 同名元素重复出现时转为列表, 叶子节点取文本
+func decodeXml(body []byte, r *http.Request) (Binder, error) {
+	var data map[string]any
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			if start, ok := token.(xml.StartElement); ok {
+				v, err := decodeXmlElement(decoder, start)
+				if err != nil {
+					return nil, err
+				}
+				data, _ = v.(map[string]any)
+				break
+			}
+		}
+	}
+	return GetBinderOfMap(data), nil
+}
+
+func decodeXmlElement(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	var text strings.Builder
+	var children map[string]any
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			v, err := decodeXmlElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = make(map[string]any)
+			}
+			name := t.Name.Local
+			if exists, ok := children[name]; !ok {
+				children[name] = v
+			} else if list, ok := exists.([]any); ok {
+				children[name] = append(list, v)
+			} else {
+				children[name] = []any{exists, v}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return strings.TrimSpace(text.String()), nil
+		}
+	}
+}
+
+// decodeCsv 第一行为列名; 只有一行数据时列名即参数名, 所有数据行同时以 rows 列表传入
+func decodeCsv(body []byte, r *http.Request) (Binder, error) {
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	data := make(map[string]any)
+	if len(records) > 1 {
+		columns, rows := records[0], make([]any, 0, len(records)-1)
+		for _, record := range records[1:] {
+			row := make(map[string]any, len(columns))
+			for i, column := range columns {
+				if i < len(record) {
+					row[column] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 1 {
+			for k, v := range rows[0].(map[string]any) {
+				data[k] = v
+			}
+		}
+		data["rows"] = rows
+	}
+	return GetBinderOfMap(data), nil
+}
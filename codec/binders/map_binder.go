@@ -82,6 +82,10 @@ func (b *mapBinder) bindValue(v reflect.Value, s reflect.StructField, source map
 		if arr, ok := val.([]any); ok {
 			return b.bindSlice(v, s, arr, fullKey)
 		}
+		if s.Type.Elem().Kind() != reflect.Uint8 {
+			// xml/csv 等格式无法区分单个元素与列表
+			return b.bindSlice(v, s, []any{val}, fullKey)
+		}
 		return nil
 	default:
 		return setValWithString(v, s, fmt.Sprint(val))
@@ -0,0 +1,52 @@
+package binders
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// pathBinder 优先从路由路径参数中取值, 未命中时交给 next 处理
+type pathBinder struct {
+	params url.Values
+	values Binder
+	next   Binder
+}
+
+func GetBinderOfPath(params map[string]string, next Binder) Binder {
+	if len(params) == 0 && next != nil {
+		return next
+	}
+	values := make(url.Values, len(params))
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return &pathBinder{params: values, values: GetBinderOfUrlValue(values, nil), next: next}
+}
+
+func (b *pathBinder) Name() string {
+	return "path"
+}
+
+func (b *pathBinder) Get(key string) interface{} {
+	if _, ok := b.params[key]; ok || b.next == nil {
+		return b.params.Get(key)
+	}
+	return b.next.Get(key)
+}
+
+func (b *pathBinder) Bind(v reflect.Value, s reflect.StructField) error {
+	keys := s.Tag.Get("key")
+	if keys == "" {
+		keys = s.Name
+	}
+	for _, key := range strings.Split(keys, ",") {
+		if _, ok := b.params[strings.TrimSpace(key)]; ok {
+			return b.values.Bind(v, s)
+		}
+	}
+	if b.next == nil {
+		return b.values.Bind(v, s)
+	}
+	return b.next.Bind(v, s)
+}
@@ -13,10 +13,20 @@ type urlValueBinder struct {
 	values url.Values
 	keys   []string
 	files  map[string][]*multipart.FileHeader
+	stream bool
 }
 
 func GetBinderOfUrlValue(values url.Values, files map[string][]*multipart.FileHeader) Binder {
-	binder := &urlValueBinder{values: values, files: files}
+	return newUrlValueBinder(values, files, false)
+}
+
+// GetBinderOfUrlValueStream 上传文件不预读到内存, binders.File 字段通过 Open 读取内容
+func GetBinderOfUrlValueStream(values url.Values, files map[string][]*multipart.FileHeader) Binder {
+	return newUrlValueBinder(values, files, true)
+}
+
+func newUrlValueBinder(values url.Values, files map[string][]*multipart.FileHeader, stream bool) *urlValueBinder {
+	binder := &urlValueBinder{values: values, files: files, stream: stream}
 	for k, v := range values {
 		if len(v) > 0 {
 			binder.keys = append(binder.keys, k)
@@ -89,7 +99,7 @@ func (b urlValueBinder) bindValue(v reflect.Value, s reflect.StructField, preKey
 		if s.Type.String() == "time.Time" {
 			return setValWithString(v, s, b.values.Get(skey))
 		} else if s.Type.String() == "binders.File" {
-			return setValWithFile(v, b.files[skey])
+			return setValWithFile(v, b.files[skey], b.stream)
 		} else {
 			return b.bindStructWithUrlValue(v, ckey)
 		}
@@ -0,0 +1,191 @@
+package compressors
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+	NewWriter(w io.Writer) (Writer, error)
+}
+
+// Writer 流式压缩, Flush 将已写入的数据压缩输出
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Reader 支持流式解压的算法实现该接口, DecompressLimit 在超出上限时即停止解压
+type Reader interface {
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// MaxDecompressSize 内置算法 Decompress 解压结果的上限, 避免压缩炸弹耗尽内存
+var MaxDecompressSize int64 = 64 << 20
+
+var ErrTooLarge = errors.New("decompressed data too large")
+
+var (
+	mu          sync.RWMutex
+	compressors = map[string]Compressor{}
+	preferences []string
+)
+
+func init() {
+	Register(GetCompressorOfZstd())
+	Register(GetCompressorOfGzip())
+	Register(GetCompressorOfDeflate())
+}
+
+// Register 注册压缩算法, 先注册的优先级更高
+func Register(c Compressor) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := compressors[c.Name()]; !ok {
+		preferences = append(preferences, c.Name())
+	}
+	compressors[c.Name()] = c
+}
+
+func Get(name string) Compressor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return compressors[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// DecompressLimit 解压 data, 结果超过 limit 字节时返回 ErrTooLarge
+func DecompressLimit(c Compressor, data []byte, limit int64) ([]byte, error) {
+	r, ok := c.(Reader)
+	if !ok {
+		out, err := c.Decompress(data)
+		if err == nil && int64(len(out)) > limit {
+			return nil, ErrTooLarge
+		}
+		return out, err
+	}
+
+	rc, err := r.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	out, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err == nil && int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, err
+}
+
+// AcceptEncoding 返回所有已注册算法, 用于请求方的 Accept-Encoding
+func AcceptEncoding() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return strings.Join(preferences, ", ")
+}
+
+// Negotiate 根据 Accept-Encoding 选择压缩算法, allowed 为空时允许所有已注册算法, 没有匹配时返回nil
+func Negotiate(acceptEncoding string, allowed []string) Compressor {
+	if acceptEncoding == "" {
+		return nil
+	}
+
+	var wildcard = -1.0
+	var candidates []candidate
+	var rejected = map[string]bool{}
+	for index, item := range strings.Split(acceptEncoding, ",") {
+		name, q := parseQuality(item)
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		if q <= 0 {
+			rejected[name] = true
+			continue
+		}
+		candidates = append(candidates, candidate{name: name, q: q, index: index})
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if wildcard > 0 {
+		for i, name := range preferences {
+			if !rejected[name] && !containsCandidate(candidates, name) {
+				candidates = append(candidates, candidate{name: name, q: wildcard, index: len(candidates) + i})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if cp, ok := compressors[c.name]; ok && isAllowed(c.name, allowed) {
+			return cp
+		}
+	}
+	return nil
+}
+
+// NegotiateCompress 按 Accept-Encoding 协商并压缩, data 不足 minSize 或没有可用算法时原样返回且 encoding 为空
+func NegotiateCompress(data []byte, acceptEncoding string, minSize int, allowed []string) ([]byte, string, error) {
+	if len(data) == 0 || len(data) < minSize {
+		return data, "", nil
+	}
+	if c := Negotiate(acceptEncoding, allowed); c != nil {
+		compressed, err := c.Compress(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return compressed, c.Name(), nil
+	}
+	return data, "", nil
+}
+
+func parseQuality(item string) (name string, q float64) {
+	q = 1
+	name = strings.ToLower(strings.TrimSpace(item))
+	if idx := strings.IndexByte(name, ';'); idx >= 0 {
+		param := strings.TrimSpace(name[idx+1:])
+		name = strings.TrimSpace(name[:idx])
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return
+}
+
+type candidate struct {
+	name  string
+	q     float64
+	index int
+}
+
+func containsCandidate(candidates []candidate, name string) bool {
+	for _, c := range candidates {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowed(name string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, v := range allowed {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package compressors
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+)
+
+var dCompressor = &deflateCompressor{}
+
+// deflateCompressor HTTP 的 deflate 编码实际为 zlib 格式 (RFC 1950)
+type deflateCompressor struct {
+}
+
+func GetCompressorOfDeflate() Compressor {
+	return dCompressor
+}
+
+func (c deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (c deflateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c deflateCompressor) Decompress(data []byte) ([]byte, error) {
+	return DecompressLimit(c, data, MaxDecompressSize)
+}
+
+func (c deflateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	// 兼容直接发送 raw deflate 数据的实现
+	return flate.NewReader(br), nil
+}
+
+func (c deflateCompressor) NewWriter(w io.Writer) (Writer, error) {
+	return zlib.NewWriter(w), nil
+}
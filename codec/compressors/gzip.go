@@ -0,0 +1,52 @@
+package compressors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+var gCompressor = &gzipCompressor{}
+
+var gzipWriterPool = sync.Pool{New: func() interface{} {
+	return gzip.NewWriter(nil)
+}}
+
+type gzipCompressor struct {
+}
+
+func GetCompressorOfGzip() Compressor {
+	return gCompressor
+}
+
+func (c gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	return DecompressLimit(c, data, MaxDecompressSize)
+}
+
+func (c gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (c gzipCompressor) NewWriter(w io.Writer) (Writer, error) {
+	return gzip.NewWriter(w), nil
+}
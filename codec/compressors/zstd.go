@@ -0,0 +1,56 @@
+package compressors
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var zCompressor = &zstdCompressor{}
+
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	err     error
+}
+
+func GetCompressorOfZstd() Compressor {
+	return zCompressor
+}
+
+// init EncodeAll 可并发调用, 全局共用一个编码器
+func (c *zstdCompressor) init() error {
+	c.once.Do(func() {
+		c.encoder, c.err = zstd.NewWriter(nil)
+	})
+	return c.err
+}
+
+func (c *zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+}
+
+func (c *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return DecompressLimit(c, data, MaxDecompressSize)
+}
+
+// NewReader DecodeAll 无法在超出上限时提前停止, 解压使用单协程的流式解码器
+func (c *zstdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func (c *zstdCompressor) NewWriter(w io.Writer) (Writer, error) {
+	return zstd.NewWriter(w)
+}
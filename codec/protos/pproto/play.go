@@ -2,12 +2,14 @@ package pproto
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"math"
 	"time"
 	"unsafe"
 
 	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/codec/compressors"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 )
 
@@ -57,20 +59,69 @@ import (
 // 4 byte : attachment长度
 // header body attachment
 
+// request protocol v5
+// 4 byte : ==>>
+// 4 byte : dataSize
+// 1 byte : version
+// 8 byte : requestId 同一连接上多路复用时用于关联响应
+// 1 byte : flags
+// 1 byte : render 0:json
+// 1 byte : action长度
+// 4 byte : header长度
+// 4 byte : body长度
+// 4 byte : attachment长度
+// action header body attachment
+
+// response protocol v5
+// 4 byte : <<==
+// 4 byte : dataSize
+// 1 byte : version
+// 8 byte : requestId
+// 1 byte : flags
+// 1 byte : render 0:json
+// 4 byte : rc错误码
+// 4 byte : header长度
+// 4 byte : body长度
+// 4 byte : attachment长度
+// header body attachment
+
+// v5 flags
+const (
+	FlagNonRespond byte = 1 << iota // 请求不需要响应
+	FlagCompressed                  // body 已压缩, 算法见 header 中的 encoding
+	FlagStream                      // 流式响应, 同一 requestId 之后还有帧
+	FlagCancel                      // 请求方已放弃等待, 取消同一连接上 requestId 相同的请求, 帧中不携带 action 与 body
+)
+
+// MaxFrameSize 单帧 dataSize 及 body 解压后的上限, 超出时解包返回 ErrFrameTooLarge, 避免异常数据导致无限缓存
+var MaxFrameSize uint32 = 64 << 20
+
+var ErrFrameTooLarge = errors.New("socket protocol frame too large")
+
+// header 中的 encoding 表示 body 的压缩算法, acceptEncoding 为请求方可解压的算法列表
 type requestHeader struct {
-	TraceId  string    `key:"traceId" json:"traceId"`
-	SpanId   []byte    `key:"spanId" json:"spanId"`
-	CallerId int       `key:"callerId" json:"callerId"`
-	TagId    int       `key:"tagId" json:"tagId"`
-	Deadline time.Time `key:"deadline" json:"deadline"`
+	TraceId        string    `key:"traceId" json:"traceId"`
+	RequestId      string    `key:"requestId" json:"requestId,omitempty"`
+	SpanId         []byte    `key:"spanId" json:"spanId"`
+	CallerId       int       `key:"callerId" json:"callerId"`
+	TagId          int       `key:"tagId" json:"tagId"`
+	Deadline       time.Time `key:"deadline" json:"deadline"`
+	Encoding       string    `key:"encoding" json:"encoding,omitempty"`
+	AcceptEncoding string    `key:"acceptEncoding" json:"acceptEncoding,omitempty"`
 }
 
 type responseHeader struct {
-	TraceId string `key:"traceId" json:"traceId"`
-	TagId   int    `key:"tagId" json:"tagId"`
+	TraceId   string              `key:"traceId" json:"traceId"`
+	RequestId string              `key:"requestId" json:"requestId,omitempty"` // 回传请求id, 客户端据此关联乱序到达的响应
+	TagId     int                 `key:"tagId" json:"tagId"`
+	Encoding  string              `key:"encoding" json:"encoding,omitempty"`
+	Status    int                 `key:"status" json:"status,omitempty"`
+	Meta      map[string][]string `key:"meta" json:"meta,omitempty"` // 响应头, cookie 以 Set-Cookie 携带
 }
 type PlayProtocolRequest struct {
 	Version    byte
+	RequestId  uint64 // v5
+	Flags      byte   // v5
 	Action     string
 	NonRespond bool
 	Render     byte
@@ -81,6 +132,8 @@ type PlayProtocolRequest struct {
 
 type PlayProtocolResponse struct {
 	Version    byte
+	RequestId  uint64 // v5
+	Flags      byte   // v5
 	Render     byte
 	ResultCode int
 	Header     responseHeader
@@ -103,6 +156,7 @@ func NewPlayProtocolRequest(ctx context.Context, callerId int, action string, me
 		request.Header.TraceId = play.NewTraceId()
 		request.Header.SpanId = []byte{1}
 	}
+	request.Header.AcceptEncoding = compressors.AcceptEncoding()
 	request.Action = action
 	request.Body = body
 	return
@@ -117,6 +171,8 @@ func MarshalProtocolRequest(request PlayProtocolRequest) ([]byte, error) {
 		buffer, err = _packRequestV2(request, buffer)
 	case 3:
 		buffer, err = _packRequestV3(request, buffer)
+	case 5:
+		buffer, err = _packRequestV5(request, buffer)
 	default:
 		buffer, err = _packRequestV4(request, buffer)
 	}
@@ -254,6 +310,9 @@ func UnmarshalProtocolRequest(data []byte) (protocol PlayProtocolRequest, dataSi
 		return protocol, 0, errors.New("socket protocol head error:" + string(data[:4]))
 	}
 
+	if _bytesToUint32(data[4:8]) > MaxFrameSize {
+		return protocol, 0, ErrFrameTooLarge
+	}
 	size := _bytesToUint32(data[4:8]) + 8
 	if uint32(len(data)) < size {
 		return
@@ -268,6 +327,8 @@ func UnmarshalProtocolRequest(data []byte) (protocol PlayProtocolRequest, dataSi
 		err = _unpackRequestV3(data, dataSize, &protocol)
 	case 4:
 		err = _unpackRequestV4(data, dataSize, &protocol)
+	case 5:
+		err = _unpackRequestV5(data, dataSize, &protocol)
 	default:
 		err = errors.New("socket protocol version error")
 	}
@@ -341,6 +402,9 @@ func _unpackRequestV4(buffer []byte, dataSize uint32, protocol *PlayProtocolRequ
 	if bodyLen > 0 {
 		protocol.Body = buffer[idx : idx+uint32(bodyLen)]
 		idx += uint32(bodyLen)
+		if protocol.Body, err = decompressBody(protocol.Header.Encoding, protocol.Body); err != nil {
+			return
+		}
 	}
 
 	if attachmentLen > 0 {
@@ -371,6 +435,8 @@ func MarshalProtocolResponse(response PlayProtocolResponse) ([]byte, error) {
 		return _packResponseV2(response, buffer)
 	case 3:
 		return _packResponseV3(response, buffer)
+	case 5:
+		return _packResponseV5(response, buffer)
 	default:
 		return _packResponseV4(response, buffer)
 	}
@@ -458,6 +524,9 @@ func UnmarshalProtocolResponse(data []byte) (protocol PlayProtocolResponse, data
 		return protocol, 0, errors.New("socket protocol head error:" + string(data[:4]) + ". data is:" + string(data))
 	}
 
+	if _bytesToUint32(data[4:8]) > MaxFrameSize {
+		return protocol, 0, ErrFrameTooLarge
+	}
 	size := _bytesToUint32(data[4:8]) + 8
 	if uint32(len(data)) < size {
 		return
@@ -471,6 +540,8 @@ func UnmarshalProtocolResponse(data []byte) (protocol PlayProtocolResponse, data
 		err = _unpackResponseV3(data, dataSize, &protocol)
 	case 4:
 		err = _unpackResponseV4(data, dataSize, &protocol)
+	case 5:
+		err = _unpackResponseV5(data, dataSize, &protocol)
 	default:
 		err = errors.New("socket protocol version error")
 	}
@@ -510,6 +581,9 @@ func _unpackResponseV4(buffer []byte, dataSize uint32, protocol *PlayProtocolRes
 	if bodyLen > 0 {
 		protocol.Body = buffer[idx : idx+uint32(bodyLen)]
 		idx += uint32(bodyLen)
+		if protocol.Body, err = decompressBody(protocol.Header.Encoding, protocol.Body); err != nil {
+			return
+		}
 	}
 
 	if attachmentLen > 0 {
@@ -530,6 +604,238 @@ func _unpackResponseV4(buffer []byte, dataSize uint32, protocol *PlayProtocolRes
 
 	return
 }
+
+func _packRequestV5(request PlayProtocolRequest, buffer []byte) ([]byte, error) {
+	if len(request.Action) > 255 {
+		return nil, errors.New("action length error must less than 255")
+	}
+	header, err := json.Marshal(request.Header)
+	if err != nil {
+		return nil, err
+	}
+	attachment, err := _packAttachment(request.Attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags = request.Flags
+	if request.NonRespond {
+		flags |= FlagNonRespond
+	}
+	if request.Header.Encoding != "" {
+		flags |= FlagCompressed
+	}
+
+	// dataSize的值不包括==>>4个字节 和 dataSize 4个字节
+	var dataSize = 24 + len(request.Action) + len(header) + len(request.Body) + len(attachment)
+	if uint64(dataSize) > uint64(MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+
+	buffer = append(buffer, _intToBytes(dataSize)...)
+	buffer = append(buffer, byte(5))
+	buffer = append(buffer, _uint64ToBytes(request.RequestId)...)
+	buffer = append(buffer, flags)
+	buffer = append(buffer, request.Render)
+	buffer = append(buffer, uint8(len(request.Action)))
+	buffer = append(buffer, _intToBytes(len(header))...)
+	buffer = append(buffer, _intToBytes(len(request.Body))...)
+	buffer = append(buffer, _intToBytes(len(attachment))...)
+
+	buffer = append(buffer, []byte(request.Action)...)
+	buffer = append(buffer, header...)
+	buffer = append(buffer, request.Body...)
+	buffer = append(buffer, attachment...)
+
+	return buffer, nil
+}
+
+func _unpackRequestV5(buffer []byte, dataSize uint32, protocol *PlayProtocolRequest) (err error) {
+	if dataSize < 32 {
+		return errors.New("socket protocol format error")
+	}
+	protocol.RequestId = _bytesToUint64(buffer[9:17])
+	protocol.Flags = buffer[17]
+	protocol.Render = buffer[18]
+	protocol.NonRespond = protocol.Flags&FlagNonRespond > 0
+
+	actionLen := uint32(buffer[19])
+	headerLen := _bytesToUint32(buffer[20:24])
+	bodyLen := _bytesToUint32(buffer[24:28])
+	attachmentLen := _bytesToUint32(buffer[28:32])
+	if uint64(32)+uint64(actionLen)+uint64(headerLen)+uint64(bodyLen)+uint64(attachmentLen) != uint64(dataSize) {
+		return errors.New("socket protocol format error")
+	}
+
+	var idx uint32 = 32
+	protocol.Action = string(buffer[idx : idx+actionLen])
+	idx += actionLen
+	if headerLen > 0 {
+		if err = json.Unmarshal(buffer[idx:idx+headerLen], &protocol.Header); err != nil {
+			return
+		}
+		idx += headerLen
+	}
+	if bodyLen > 0 {
+		protocol.Body = buffer[idx : idx+bodyLen]
+		idx += bodyLen
+		if protocol.Flags&FlagCompressed > 0 {
+			if protocol.Body, err = decompressBody(protocol.Header.Encoding, protocol.Body); err != nil {
+				return
+			}
+		}
+	}
+	protocol.Attachment, err = _unpackAttachment(buffer[idx : idx+attachmentLen])
+	return
+}
+
+func _packResponseV5(response PlayProtocolResponse, buffer []byte) ([]byte, error) {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return nil, err
+	}
+	attachment, err := _packAttachment(response.Attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags = response.Flags
+	if response.Header.Encoding != "" {
+		flags |= FlagCompressed
+	}
+
+	// dataSize的值不包括<<==4个字节 和 dataSize 4个字节
+	dataSize := 27 + len(header) + len(response.Body) + len(attachment)
+	if uint64(dataSize) > uint64(MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+
+	buffer = append(buffer, _intToBytes(dataSize)...)
+	buffer = append(buffer, byte(5))
+	buffer = append(buffer, _uint64ToBytes(response.RequestId)...)
+	buffer = append(buffer, flags)
+	buffer = append(buffer, response.Render)
+	buffer = append(buffer, _intToBytes(response.ResultCode)...)
+	buffer = append(buffer, _intToBytes(len(header))...)
+	buffer = append(buffer, _intToBytes(len(response.Body))...)
+	buffer = append(buffer, _intToBytes(len(attachment))...)
+
+	buffer = append(buffer, header...)
+	buffer = append(buffer, response.Body...)
+	buffer = append(buffer, attachment...)
+	return buffer, nil
+}
+
+func _unpackResponseV5(buffer []byte, dataSize uint32, protocol *PlayProtocolResponse) (err error) {
+	if dataSize < 35 {
+		return errors.New("socket protocol format error")
+	}
+	protocol.RequestId = _bytesToUint64(buffer[9:17])
+	protocol.Flags = buffer[17]
+	protocol.Render = buffer[18]
+	protocol.ResultCode = _bytesToInt(buffer[19:23])
+
+	headerLen := _bytesToUint32(buffer[23:27])
+	bodyLen := _bytesToUint32(buffer[27:31])
+	attachmentLen := _bytesToUint32(buffer[31:35])
+	if uint64(35)+uint64(headerLen)+uint64(bodyLen)+uint64(attachmentLen) != uint64(dataSize) {
+		return errors.New("socket protocol format error")
+	}
+
+	var idx uint32 = 35
+	if headerLen > 0 {
+		if err = json.Unmarshal(buffer[idx:idx+headerLen], &protocol.Header); err != nil {
+			return
+		}
+		idx += headerLen
+	}
+	if bodyLen > 0 {
+		protocol.Body = buffer[idx : idx+bodyLen]
+		idx += bodyLen
+		if protocol.Flags&FlagCompressed > 0 {
+			if protocol.Body, err = decompressBody(protocol.Header.Encoding, protocol.Body); err != nil {
+				return
+			}
+		}
+	}
+	protocol.Attachment, err = _unpackAttachment(buffer[idx : idx+attachmentLen])
+	return
+}
+
+// _packAttachment 附件格式: 1 byte 数量, 之后每项为 1 byte key长度, key, 4 byte value长度, value
+func _packAttachment(attachment map[string][]byte) ([]byte, error) {
+	if len(attachment) == 0 {
+		return nil, nil
+	}
+	if len(attachment) > 255 {
+		return nil, errors.New("attachment count error must less than 255")
+	}
+	var size = 1
+	for k, v := range attachment {
+		if len(k) > 255 {
+			return nil, errors.New("attachment key length error must less than 255")
+		}
+		size += len(k) + len(v) + 5
+	}
+	if uint64(size) > uint64(MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+
+	buffer := make([]byte, 0, size)
+	buffer = append(buffer, byte(len(attachment)))
+	for k, v := range attachment {
+		buffer = append(buffer, byte(len(k)))
+		buffer = append(buffer, []byte(k)...)
+		buffer = append(buffer, _intToBytes(len(v))...)
+		buffer = append(buffer, v...)
+	}
+	return buffer, nil
+}
+
+func _unpackAttachment(buffer []byte) (map[string][]byte, error) {
+	if len(buffer) == 0 {
+		return nil, nil
+	}
+	var count = int(buffer[0])
+	var idx uint32 = 1
+	var size = uint32(len(buffer))
+	var attachment = make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		if idx+1 > size {
+			return nil, errors.New("socket protocol attachment format error")
+		}
+		keyLen := uint32(buffer[idx])
+		idx++
+		if idx+keyLen+4 > size {
+			return nil, errors.New("socket protocol attachment format error")
+		}
+		key := string(buffer[idx : idx+keyLen])
+		idx += keyLen
+		valueLen := _bytesToUint32(buffer[idx : idx+4])
+		idx += 4
+		if uint64(idx)+uint64(valueLen) > uint64(size) {
+			return nil, errors.New("socket protocol attachment format error")
+		}
+		attachment[key] = buffer[idx : idx+valueLen]
+		idx += valueLen
+	}
+	return attachment, nil
+}
+
+func decompressBody(encoding string, body []byte) ([]byte, error) {
+	if encoding == "" || len(body) == 0 {
+		return body, nil
+	}
+	if c := compressors.Get(encoding); c != nil {
+		body, err := compressors.DecompressLimit(c, body, int64(MaxFrameSize))
+		if errors.Is(err, compressors.ErrTooLarge) {
+			return nil, ErrFrameTooLarge
+		}
+		return body, err
+	}
+	return nil, errors.New("unsupported body encoding:" + encoding)
+}
+
 func _bytesToUint32(data []byte) uint32 {
 	var ret uint32
 	var l = len(data)
@@ -573,6 +879,14 @@ func _intToBytes(data int) (ret []byte) {
 	return ret
 }
 
+func _bytesToUint64(data []byte) uint64 {
+	return binary.LittleEndian.Uint64(data)
+}
+
+func _uint64ToBytes(data uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, data)
+}
+
 func _uint16ToBytes(data uint16) (ret []byte) {
 	var sizeof = unsafe.Sizeof(data)
 	ret = make([]byte, sizeof)
@@ -0,0 +1,175 @@
+package pproto
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/leochen2038/play/codec/compressors"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	out, err := compressors.Get(encoding).Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestProtocolRequestV5(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"name":"play"}`), 64)
+	tests := []struct {
+		name     string
+		encoding string
+		request  PlayProtocolRequest
+	}{
+		{name: "plain", request: PlayProtocolRequest{RequestId: 1, Action: "user.get", Render: 1, Body: body}},
+		{name: "non respond", request: PlayProtocolRequest{RequestId: 2, Action: "user.log", NonRespond: true, Body: body}},
+		{name: "attachment", request: PlayProtocolRequest{RequestId: 3, Action: "user.put", Body: body, Attachment: map[string][]byte{"file": []byte("content")}}},
+		{name: "empty body", request: PlayProtocolRequest{RequestId: 1 << 40, Action: "ping"}},
+		{name: "gzip", encoding: "gzip", request: PlayProtocolRequest{RequestId: 4, Action: "user.get", Body: body}},
+		{name: "deflate", encoding: "deflate", request: PlayProtocolRequest{RequestId: 5, Action: "user.get", Body: body}},
+		{name: "zstd", encoding: "zstd", request: PlayProtocolRequest{RequestId: 6, Action: "user.get", Body: body}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			request.Version = 5
+			request.Header.TraceId = "trace"
+			if tt.encoding != "" {
+				request.Header.Encoding = tt.encoding
+				request.Body = compress(t, tt.encoding, request.Body)
+			}
+			data, err := MarshalProtocolRequest(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 不完整的帧等待更多数据
+			if _, size, err := UnmarshalProtocolRequest(data[:len(data)-1]); size != 0 || err != nil {
+				t.Fatalf("partial frame: size = %d, err = %v", size, err)
+			}
+
+			got, size, err := UnmarshalProtocolRequest(append(data, "==>>"...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(size) != len(data) {
+				t.Fatalf("size = %d, want %d", size, len(data))
+			}
+			if got.RequestId != tt.request.RequestId || got.Action != tt.request.Action || got.Render != tt.request.Render || got.NonRespond != tt.request.NonRespond {
+				t.Fatalf("got %+v, want %+v", got, tt.request)
+			}
+			if (got.Flags&FlagCompressed > 0) != (tt.encoding != "") {
+				t.Fatalf("flags = %b", got.Flags)
+			}
+			if !bytes.Equal(got.Body, tt.request.Body) {
+				t.Fatalf("body = %q, want %q", got.Body, tt.request.Body)
+			}
+			if len(tt.request.Attachment) > 0 && !reflect.DeepEqual(got.Attachment, tt.request.Attachment) {
+				t.Fatalf("attachment = %v, want %v", got.Attachment, tt.request.Attachment)
+			}
+		})
+	}
+}
+
+func TestProtocolResponseV5(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"rc":0}`), 64)
+	tests := []struct {
+		name     string
+		encoding string
+		response PlayProtocolResponse
+	}{
+		{name: "plain", response: PlayProtocolResponse{RequestId: 1, ResultCode: 0, Body: body}},
+		{name: "stream", response: PlayProtocolResponse{RequestId: 2, Flags: FlagStream, Body: body}},
+		{name: "error code", response: PlayProtocolResponse{RequestId: 3, ResultCode: 404}},
+		{name: "attachment", response: PlayProtocolResponse{RequestId: 4, Body: body, Attachment: map[string][]byte{"k": {1, 2, 3}}}},
+		{name: "gzip", encoding: "gzip", response: PlayProtocolResponse{RequestId: 5, Body: body}},
+		{name: "zstd", encoding: "zstd", response: PlayProtocolResponse{RequestId: 6, Body: body}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := tt.response
+			response.Version = 5
+			response.Header.RequestId = "r"
+			if tt.encoding != "" {
+				response.Header.Encoding = tt.encoding
+				response.Body = compress(t, tt.encoding, response.Body)
+			}
+			data, err := MarshalProtocolResponse(response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, size, err := UnmarshalProtocolResponse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(size) != len(data) {
+				t.Fatalf("size = %d, want %d", size, len(data))
+			}
+			if got.RequestId != tt.response.RequestId || got.ResultCode != tt.response.ResultCode || got.Flags&FlagStream != tt.response.Flags&FlagStream {
+				t.Fatalf("got %+v, want %+v", got, tt.response)
+			}
+			if !bytes.Equal(got.Body, tt.response.Body) {
+				t.Fatalf("body = %q, want %q", got.Body, tt.response.Body)
+			}
+			if len(tt.response.Attachment) > 0 && !reflect.DeepEqual(got.Attachment, tt.response.Attachment) {
+				t.Fatalf("attachment = %v, want %v", got.Attachment, tt.response.Attachment)
+			}
+		})
+	}
+}
+
+func TestProtocolFrameTooLarge(t *testing.T) {
+	defer func(size uint32) { MaxFrameSize = size }(MaxFrameSize)
+	MaxFrameSize = 1024
+
+	// 解压后超出上限的 body 与超长的帧一样被拒绝
+	bomb := bytes.Repeat([]byte{'a'}, 64<<10)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		marshal  error
+	}{
+		{name: "frame", body: bytes.Repeat([]byte{'a'}, 2048), marshal: ErrFrameTooLarge},
+		{name: "gzip", encoding: "gzip", body: bomb},
+		{name: "deflate", encoding: "deflate", body: bomb},
+		{name: "zstd", encoding: "zstd", body: bomb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := PlayProtocolRequest{Version: 5, Action: "a", Body: tt.body}
+			response := PlayProtocolResponse{Version: 5, Body: tt.body}
+			if tt.encoding != "" {
+				request.Header.Encoding, response.Header.Encoding = tt.encoding, tt.encoding
+				request.Body = compress(t, tt.encoding, tt.body)
+				response.Body = request.Body
+			}
+
+			data, err := MarshalProtocolRequest(request)
+			if !errors.Is(err, tt.marshal) {
+				t.Fatalf("marshal request err = %v, want %v", err, tt.marshal)
+			}
+			if tt.marshal != nil {
+				// 对端未限制时写出的超长帧, 读取帧头即拒绝
+				data = append([]byte("==>>"), _intToBytes(int(MaxFrameSize)+1)...)
+			}
+			if _, _, err = UnmarshalProtocolRequest(append(data, 5)); !errors.Is(err, ErrFrameTooLarge) {
+				t.Fatalf("unmarshal request err = %v, want %v", err, ErrFrameTooLarge)
+			}
+
+			if data, err = MarshalProtocolResponse(response); !errors.Is(err, tt.marshal) {
+				t.Fatalf("marshal response err = %v, want %v", err, tt.marshal)
+			}
+			if tt.marshal != nil {
+				data = append([]byte("<<=="), _intToBytes(int(MaxFrameSize)+1)...)
+			}
+			if _, _, err = UnmarshalProtocolResponse(append(data, 5)); !errors.Is(err, ErrFrameTooLarge) {
+				t.Fatalf("unmarshal response err = %v, want %v", err, ErrFrameTooLarge)
+			}
+		})
+	}
+}
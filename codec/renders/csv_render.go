@@ -0,0 +1,94 @@
+package renders
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+)
+
+var cRender = &csvRender{}
+
+// csvRender 输出只有一个列表字段时, 列表的每个元素为一行; 否则整个输出作为一行
+// 列名为所有行字段的并集, 嵌套的对象和列表以json编码写入单元格
+type csvRender struct {
+}
+
+func GetRenderOfCsv() Render {
+	return cRender
+}
+
+func (r csvRender) Name() string {
+	return "csv"
+}
+
+func (r csvRender) Render(data map[string]interface{}) ([]byte, error) {
+	v, err := normalize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]interface{}
+	var list, isList = []interface{}(nil), false
+	if len(v) == 1 {
+		for _, item := range v {
+			list, isList = item.([]interface{})
+		}
+	}
+	if isList {
+		for _, item := range list {
+			if row, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, row)
+			} else {
+				rows = append(rows, map[string]interface{}{"value": item})
+			}
+		}
+	} else {
+		rows = append(rows, v)
+	}
+
+	var columns []string
+	var exists = make(map[string]struct{})
+	for _, row := range rows {
+		for k := range row {
+			if _, ok := exists[k]; !ok {
+				exists[k] = struct{}{}
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err = writer.Write(columns); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			if record[i], err = csvCell(row[column]); err != nil {
+				return nil, err
+			}
+		}
+		if err = writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.MarshalEscape(v, false, false)
+		return string(data), err
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,34 @@
+package renders
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var mRender = &msgpackRender{}
+
+type msgpackRender struct {
+}
+
+func GetRenderOfMsgpack() Render {
+	return mRender
+}
+
+func (r msgpackRender) Name() string {
+	return "msgpack"
+}
+
+func (r msgpackRender) Render(data map[string]interface{}) ([]byte, error) {
+	v, err := normalize(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+	if err = encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -1,6 +1,181 @@
 package renders
 
+import (
+	"bytes"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+)
+
 type Render interface {
 	Name() string
 	Render(data map[string]interface{}) ([]byte, error)
 }
+
+type entry struct {
+	render      Render
+	contentType string
+	mediaType   string
+}
+
+var (
+	mu      sync.RWMutex
+	entries = map[string]*entry{}
+	ordered []string // 注册顺序, Accept 为通配时按此顺序选择
+)
+
+// protobuf 需要消息描述, 不做默认注册, 可通过 Register(GetRenderOfProtobuf(desc), "application/x-protobuf") 注册
+func init() {
+	Register(GetRenderOfJson(), "application/json; charset=utf-8")
+	Register(GetRenderOfXml(), "application/xml; charset=utf-8")
+	Register(GetRenderOfYaml(), "application/yaml; charset=utf-8", "yml")
+	Register(GetRenderOfMsgpack(), "application/msgpack", "mpk")
+	Register(GetRenderOfCsv(), "text/csv; charset=utf-8")
+}
+
+// Register 注册render, 以 Name() 及 exts 作为URL扩展名索引, 以 contentType 参与 Accept 协商
+// 同名注册会覆盖已有的render
+func Register(render Render, contentType string, exts ...string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	e := &entry{render: render, contentType: contentType, mediaType: mediaType}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range append([]string{render.Name()}, exts...) {
+		if _, ok := entries[name]; !ok {
+			ordered = append(ordered, name)
+		}
+		entries[name] = e
+	}
+}
+
+// Get 按名称或扩展名获取render, 未注册返回nil
+func Get(name string) Render {
+	mu.RLock()
+	defer mu.RUnlock()
+	if e, ok := entries[name]; ok {
+		return e.render
+	}
+	return nil
+}
+
+// ContentType 返回render对应的 Content-Type
+func ContentType(name string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if e, ok := entries[name]; ok {
+		return e.contentType
+	}
+	return ""
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// Negotiate 按 Accept 头选择render名称, 按 q 值从高到低匹配, q 值相同时具体类型优先于通配
+// accept 为空时返回 defaultName, 通配类型优先匹配 defaultName, 无匹配返回空字符串
+func Negotiate(accept string, defaultName string) string {
+	if strings.TrimSpace(accept) == "" {
+		return defaultName
+	}
+
+	var ranges []acceptRange
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].mediaType != "*/*" && ranges[j].mediaType == "*/*"
+	})
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, r := range ranges {
+		if e, ok := entries[defaultName]; ok && matchMediaType(r.mediaType, e.mediaType) {
+			return defaultName
+		}
+		for _, name := range ordered {
+			if matchMediaType(r.mediaType, entries[name].mediaType) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, pattern[:len(pattern)-1])
+	}
+	return false
+}
+
+// normalize 按 key/json 标签把输出转换为 map/slice/基础类型, 供非json格式的render使用
+func normalize(data map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.MarshalEscape(data, false, false)
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err = decoder.Decode(&v); err != nil || v == nil {
+		return map[string]interface{}{}, err
+	}
+	return normalizeNumber(v).(map[string]interface{}), nil
+}
+
+func normalizeNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeNumber(item)
+		}
+	case []interface{}:
+		for k, item := range v {
+			v[k] = normalizeNumber(item)
+		}
+	}
+	return v
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,32 @@
+package renders
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "empty", accept: "", want: "json"},
+		{name: "any", accept: "*/*", want: "json"},
+		{name: "exact", accept: "application/xml", want: "xml"},
+		{name: "with params", accept: "application/yaml; charset=utf-8", want: "yaml"},
+		{name: "q order", accept: "application/xml;q=0.5, text/csv", want: "csv"},
+		{name: "specific before any", accept: "application/xml;q=1, */*;q=0.1", want: "xml"},
+		{name: "any before lower q", accept: "*/*, application/xml;q=0.5", want: "json"},
+		{name: "specific wins tie with any", accept: "*/*, application/xml", want: "xml"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", want: "json"},
+		{name: "subtype wildcard", accept: "text/*", want: "csv"},
+		{name: "no match", accept: "text/html", want: ""},
+		{name: "zero q", accept: "application/xml;q=0", want: ""},
+		{name: "invalid q skipped", accept: "application/xml;q=x, text/csv", want: "csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.accept, "json"); got != tt.want {
+				t.Fatalf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
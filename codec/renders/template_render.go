@@ -0,0 +1,193 @@
+package renders
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+var (
+	templateMu  sync.RWMutex
+	templateMap = map[string]*TemplateRender{}
+	templateDef *TemplateRender
+)
+
+// TemplateRender 基于 html/template 的页面渲染, 模板名为相对 root 的路径(不含扩展名)
+// 页面通过 {{define "content"}} 嵌入布局, 未定义 content 的页面单独渲染
+type TemplateRender struct {
+	root     string
+	ext      string
+	layout   string
+	partials string
+	funcs    template.FuncMap
+	reload   bool
+	mu       sync.RWMutex
+	cache    map[string]*template.Template
+}
+
+func NewTemplateRender(root string) *TemplateRender {
+	return &TemplateRender{root: root, ext: ".html", partials: "partials", funcs: template.FuncMap{}, cache: make(map[string]*template.Template)}
+}
+
+// RegisterTemplate 注册模板渲染, Response.TemplateRoot 与 root 一致时使用, TemplateRoot 为空时使用最先注册的模板
+func RegisterTemplate(t *TemplateRender) {
+	templateMu.Lock()
+	defer templateMu.Unlock()
+	templateMap[t.root] = t
+	if templateDef == nil {
+		templateDef = t
+	}
+}
+
+func LookupTemplate(root string) *TemplateRender {
+	templateMu.RLock()
+	defer templateMu.RUnlock()
+	if root == "" {
+		return templateDef
+	}
+	return templateMap[root]
+}
+
+func (r *TemplateRender) Root() string {
+	return r.root
+}
+
+// WithLayout 设置布局模板, 布局中通过 {{template "content" .}} 引入页面
+func (r *TemplateRender) WithLayout(name string) *TemplateRender {
+	r.layout = name
+	return r
+}
+
+// WithPartials 设置公共片段目录(相对root), 目录下的模板对所有页面可见, 默认 partials
+func (r *TemplateRender) WithPartials(dir string) *TemplateRender {
+	r.partials = dir
+	return r
+}
+
+func (r *TemplateRender) WithExt(ext string) *TemplateRender {
+	r.ext = "." + strings.TrimPrefix(ext, ".")
+	return r
+}
+
+func (r *TemplateRender) WithFuncs(funcs template.FuncMap) *TemplateRender {
+	for k, v := range funcs {
+		r.funcs[k] = v
+	}
+	return r
+}
+
+// WithReload 开发模式下每次渲染都重新读取模板文件
+func (r *TemplateRender) WithReload(reload bool) *TemplateRender {
+	r.reload = reload
+	return r
+}
+
+func (r *TemplateRender) Render(name string, data map[string]interface{}) ([]byte, error) {
+	t, err := r.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	entry := name
+	if r.layout != "" && t.Lookup("content") != nil {
+		entry = r.layout
+	}
+	if err = t.ExecuteTemplate(&buf, entry, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *TemplateRender) lookup(name string) (*template.Template, error) {
+	if !r.reload {
+		r.mu.RLock()
+		t, ok := r.cache[name]
+		r.mu.RUnlock()
+		if ok {
+			return t, nil
+		}
+	}
+
+	t, err := r.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.reload {
+		r.mu.Lock()
+		r.cache[name] = t
+		r.mu.Unlock()
+	}
+	return t, nil
+}
+
+func (r *TemplateRender) parse(name string) (*template.Template, error) {
+	page, err := r.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t := template.New(name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (template.JS, error) {
+			data, err := json.MarshalEscape(v, false, true)
+			return template.JS(data), err
+		},
+		"raw": func(s string) template.HTML {
+			return template.HTML(s)
+		},
+	}).Funcs(r.funcs)
+
+	if r.partials != "" {
+		dir := filepath.Join(r.root, r.partials)
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(path) != r.ext {
+				return err
+			}
+			rel, _ := filepath.Rel(r.root, path)
+			return r.parseFile(t, strings.TrimSuffix(filepath.ToSlash(rel), r.ext))
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if r.layout != "" {
+		if err = r.parseFile(t, r.layout); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = t.Parse(page); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *TemplateRender) parseFile(t *template.Template, name string) error {
+	content, err := r.readFile(name)
+	if err != nil {
+		return err
+	}
+	_, err = t.New(name).Parse(content)
+	return err
+}
+
+func (r *TemplateRender) readFile(name string) (string, error) {
+	path := filepath.Join(r.root, filepath.FromSlash(name)+r.ext)
+	if rel, err := filepath.Rel(r.root, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", errors.New("invalid template name:" + name)
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return string(content), err
+}
@@ -0,0 +1,69 @@
+package renders
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+var xRender = &xmlRender{}
+
+// xmlRender 以 <response> 为根节点, 列表按元素名重复输出
+type xmlRender struct {
+}
+
+func GetRenderOfXml() Render {
+	return xRender
+}
+
+func (r xmlRender) Name() string {
+	return "xml"
+}
+
+func (r xmlRender) Render(data map[string]interface{}) ([]byte, error) {
+	v, err := normalize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err = r.encode(encoder, "response", v); err != nil {
+		return nil, err
+	}
+	if err = encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r xmlRender) encode(encoder *xml.Encoder, name string, v interface{}) error {
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			if err := r.encode(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			if err := r.encode(encoder, key, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
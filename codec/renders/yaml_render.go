@@ -0,0 +1,26 @@
+package renders
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+var yRender = &yamlRender{}
+
+type yamlRender struct {
+}
+
+func GetRenderOfYaml() Render {
+	return yRender
+}
+
+func (r yamlRender) Name() string {
+	return "yaml"
+}
+
+func (r yamlRender) Render(data map[string]interface{}) ([]byte, error) {
+	v, err := normalize(data)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
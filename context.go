@@ -90,13 +90,16 @@ func NewPlayContext(parent context.Context, s *Session, request *Request, timeou
 		ServerName:   request.ActionName,
 	}
 	var response = Response{
-		Version:    request.Version,
-		TraceId:    traceId,
-		RenderName: request.RenderName,
-		Template:   strings.ReplaceAll(request.ActionName, ".", "/"),
+		Version:        request.Version,
+		TraceId:        traceId,
+		RequestId:      request.RequestId,
+		RenderName:     request.RenderName,
+		AcceptEncoding: request.AcceptEncoding,
+		Template:       strings.ReplaceAll(request.ActionName, ".", "/"),
+		conn:           request.Conn,
 	}
 
-	return &Context{
+	ctx := &Context{
 		ActionRequest: action,
 		Input:         NewInput(request.InputBinder),
 		Response:      response,
@@ -105,6 +108,8 @@ func NewPlayContext(parent context.Context, s *Session, request *Request, timeou
 		gctx:          gctx,
 		gcfunc:        gcfunc,
 	}
+	ctx.Input.attachments = request.Attachments
+	return ctx
 }
 
 func (c *Context) Done() <-chan struct{} {
@@ -119,8 +124,8 @@ func (c *Context) Finish() {
 	if !c.isFinish {
 		c.isFinish = true
 		c.FinishTime = time.Now()
-		if c.err == nil {
-			c.err = c.gctx.Err()
+		if c.err == nil && c.gctx.Err() != nil {
+			c.err = context.Cause(c.gctx)
 		}
 		c.gcfunc()
 	}
@@ -130,13 +135,18 @@ func (c *Context) Err() error {
 	if c.err != nil {
 		return c.err
 	}
-	if !c.isFinish {
-		return c.gctx.Err()
+	// 返回取消原因, 客户端断开时为 ErrClientClosed
+	if !c.isFinish && c.gctx.Err() != nil {
+		return context.Cause(c.gctx)
 	}
 	return nil
 }
 
 func (c *Context) Value(key interface{}) interface{} {
+	// 下游调用按请求的 TagId 路由, 见 BalanceKeyOf
+	if _, ok := key.(balanceTagCtx); ok && c.Trace != nil {
+		return c.Trace.TagId
+	}
 	return c.gctx.Value(key)
 }
 
@@ -286,6 +286,30 @@ func ParseMapInterface(v interface{}) (list map[string]interface{}, err error) {
 	return
 }
 
+// ParseByteSize 解析带单位的字节数, 如 512, 64k, 8M, 1G
+func ParseByteSize(str string) (int64, error) {
+	var unit int64 = 1
+	str = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(str)), "b")
+	if len(str) > 0 {
+		switch str[len(str)-1] {
+		case 'k':
+			unit = 1 << 10
+		case 'm':
+			unit = 1 << 20
+		case 'g':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.New("invalid byte size:" + str)
+	}
+	return size * unit, nil
+}
+
 func DecodeHost(driver, dest string) (username, password, host, database string) {
 	uIndex := strings.Index(dest, ":")
 	pIndex := strings.Index(dest, fmt.Sprintf("@%s(", driver))
@@ -0,0 +1,268 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/agents"
+	"github.com/quic-go/quic-go"
+)
+
+// Instance 服务的一个实例
+type Instance struct {
+	Address string            `json:"address"`
+	Weight  int               `json:"weight"`
+	TagId   int               `json:"tagId,omitempty"`
+	Actions []string          `json:"actions,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Discovery 查询服务的全部实例
+type Discovery interface {
+	Resolve(ctx context.Context, service string) ([]Instance, error)
+}
+
+// Registrar 注册与注销服务实例
+type Registrar interface {
+	Register(ctx context.Context, service string, instance Instance) error
+	Deregister(ctx context.Context, service string, instance Instance) error
+}
+
+// Watcher 定期查询服务实例, 有变化时通知订阅者
+// 查询失败或结果为空时保留上一次的实例, 避免注册中心异常时摘除全部服务器
+type Watcher struct {
+	discovery Discovery
+	interval  time.Duration
+	mu        sync.Mutex
+	services  map[string]*watchedService
+	cancel    context.CancelFunc
+	onError   func(service string, err error)
+}
+
+type watchedService struct {
+	instances []Instance
+	notify    []func(service string, instances []Instance)
+}
+
+func NewWatcher(discovery Discovery, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Watcher{discovery: discovery, interval: interval, services: make(map[string]*watchedService)}
+}
+
+// Watch 订阅服务实例变化, 已有实例时立即通知一次; 通知在锁外进行, 回调中可以再次调用 Watcher 的方法
+func (w *Watcher) Watch(service string, notify func(service string, instances []Instance)) *Watcher {
+	w.mu.Lock()
+	s := w.services[service]
+	if s == nil {
+		s = &watchedService{}
+		w.services[service] = s
+	}
+	s.notify = append(s.notify, notify)
+	instances := append([]Instance(nil), s.instances...)
+	w.mu.Unlock()
+
+	if len(instances) > 0 {
+		notify(service, instances)
+	}
+	return w
+}
+
+// WithErrorHandler 查询失败时的回调, 未设置时忽略错误并保留上一次的实例
+func (w *Watcher) WithErrorHandler(fn func(service string, err error)) *Watcher {
+	w.onError = fn
+	return w
+}
+
+// Start 立即查询一次, 之后按间隔在后台查询直到 Stop 或 ctx 取消
+func (w *Watcher) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	w.mu.Lock()
+	w.cancel = cancel
+	w.mu.Unlock()
+	w.Refresh(ctx)
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// Refresh 查询所有订阅的服务
+func (w *Watcher) Refresh(ctx context.Context) {
+	w.mu.Lock()
+	names := make([]string, 0, len(w.services))
+	for name := range w.services {
+		names = append(names, name)
+	}
+	w.mu.Unlock()
+
+	for _, name := range names {
+		instances, err := w.discovery.Resolve(ctx, name)
+		if err != nil {
+			if w.onError != nil {
+				w.onError(name, err)
+			}
+			continue
+		}
+		if len(instances) == 0 {
+			continue
+		}
+		sortInstances(instances)
+
+		w.mu.Lock()
+		s := w.services[name]
+		if reflect.DeepEqual(s.instances, instances) {
+			w.mu.Unlock()
+			continue
+		}
+		s.instances = instances
+		notify := append([]func(service string, instances []Instance){}, s.notify...)
+		w.mu.Unlock()
+
+		for _, fn := range notify {
+			fn(name, instances)
+		}
+	}
+}
+
+// ToGroupSocket 将实例同步到 GroupSocket 中与服务同名的分组, 只增删变化的服务器, 已有连接不受影响
+func ToGroupSocket(gs *play.GroupSocket) func(service string, instances []Instance) {
+	return func(service string, instances []Instance) {
+		var current = make(map[string]bool)
+		for host := range gs.GetHosts()[service] {
+			current[host] = true
+		}
+		for _, ins := range instances {
+			gs.SetHost(service, ins.Address, ins.Weight)
+			gs.SetHostTag(service, ins.Address, ins.TagId)
+			delete(current, ins.Address)
+		}
+		for host := range current {
+			gs.Delete(service, host)
+		}
+	}
+}
+
+// HostsRouter 支持多台服务器的 Agent, 如 agents.H2cWithJson
+type HostsRouter interface {
+	SetRouterHosts(service string, hosts map[string]int, balancer play.Balancer)
+}
+
+// ToRouter 将实例同步到 Agent 的服务路由
+func ToRouter(router HostsRouter) func(service string, instances []Instance) {
+	return func(service string, instances []Instance) {
+		router.SetRouterHosts(service, hostWeights(instances), nil)
+	}
+}
+
+// ToH2cPProtoRouter 单服务器路由, 使用权重最高的实例
+func ToH2cPProtoRouter(config map[string]interface{}) func(service string, instances []Instance) {
+	return func(service string, instances []Instance) {
+		agents.SetH2cPProtoRouter(service, "http://"+primary(instances).Address, config)
+	}
+}
+
+// ToQuicRouter 单服务器路由, 使用权重最高的实例
+func ToQuicRouter(nextProtos []string, config *quic.Config) func(service string, instances []Instance) {
+	return func(service string, instances []Instance) {
+		agents.SetQuicRouter(service, primary(instances).Address, nextProtos, config)
+	}
+}
+
+// SelfRegister 将服务实例及其 action 列表注册为 service, 每隔 interval 续约, ctx 取消时注销
+// address 为空时使用 server 的监听地址, 未指定 ip 时使用内网 ip; 首次注册失败时返回错误, 之后续约失败时调用 onError
+func SelfRegister(ctx context.Context, registrar Registrar, service string, server play.IServer, address string, interval time.Duration, onError func(err error)) error {
+	if address == "" {
+		address = advertiseAddress(server.Info().Address())
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	instance := Instance{Address: address, Weight: 1, Actions: server.ActionUnitNames()}
+	if err := registrar.Register(ctx, service, instance); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+				registrar.Deregister(dctx, service, instance)
+				cancel()
+				return
+			case <-ticker.C:
+				if err := registrar.Register(ctx, service, instance); err != nil && ctx.Err() == nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func advertiseAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if ip := play.GetIntranetIp(); ip != nil {
+			host = ip.String()
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func hostWeights(instances []Instance) map[string]int {
+	hosts := make(map[string]int, len(instances))
+	for _, ins := range instances {
+		hosts[ins.Address] = ins.Weight
+	}
+	return hosts
+}
+
+func primary(instances []Instance) Instance {
+	best := instances[0]
+	for _, ins := range instances[1:] {
+		if ins.Weight > best.Weight {
+			best = ins
+		}
+	}
+	return best
+}
+
+// sortInstances 按地址排序, 未设置权重的实例权重为1
+func sortInstances(instances []Instance) {
+	for k := range instances {
+		if instances[k].Weight == 0 {
+			instances[k].Weight = 1
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Address < instances[j].Address })
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// dnsSrvDiscovery 通过 DNS SRV 记录查询 _service._proto.domain, 只使用优先级最高(priority 最小)的记录
+type dnsSrvDiscovery struct {
+	proto    string
+	domain   string
+	resolver *net.Resolver
+}
+
+// NewDnsSrvDiscovery proto 为空时使用 tcp, resolver 为 nil 时使用系统默认解析器
+func NewDnsSrvDiscovery(proto string, domain string, resolver *net.Resolver) Discovery {
+	if proto == "" {
+		proto = "tcp"
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsSrvDiscovery{proto: proto, domain: domain, resolver: resolver}
+}
+
+func (d *dnsSrvDiscovery) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, service, d.proto, d.domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []Instance
+	for _, r := range records {
+		if r.Priority != records[0].Priority {
+			break
+		}
+		instances = append(instances, Instance{
+			Address: net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))),
+			Weight:  int(r.Weight),
+		})
+	}
+	return instances, nil
+}
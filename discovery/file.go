@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+)
+
+// fileDiscovery 从 json 文件读取服务实例, 文件修改后下次查询时重新加载:
+// {"user-service": [{"address": "10.0.0.1:9090", "weight": 10}]}
+type fileDiscovery struct {
+	filename string
+	mu       sync.Mutex
+	modTime  time.Time
+	services map[string][]Instance
+}
+
+func NewFileDiscovery(filename string) (Discovery, error) {
+	d := &fileDiscovery{filename: filename}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *fileDiscovery) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	instances, ok := d.services[service]
+	if !ok {
+		return nil, errors.New("service " + service + " not found in " + d.filename)
+	}
+	return append([]Instance(nil), instances...), nil
+}
+
+func (d *fileDiscovery) load() error {
+	info, err := os.Stat(d.filename)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.services != nil && info.ModTime().Equal(d.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(d.filename)
+	if err != nil {
+		return err
+	}
+	var services map[string][]Instance
+	if err = json.Unmarshal(data, &services); err != nil {
+		return errors.New("parse " + d.filename + " error: " + err.Error())
+	}
+	d.services, d.modTime = services, info.ModTime()
+	return nil
+}
@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leochen2038/play/codec/protos/golang/json"
+)
+
+// 注册中心 HTTP 协议:
+// GET    {base}/services/{service}               返回实例列表 json 数组
+// PUT    {base}/services/{service}               请求体为实例 json, 按 address 新增或续约
+// DELETE {base}/services/{service}?address=...   注销实例
+
+type httpRegistry struct {
+	base   string
+	client *http.Client
+}
+
+// NewHttpRegistry client 为 nil 时使用 3s 超时的默认客户端
+func NewHttpRegistry(base string, client *http.Client) *httpRegistry {
+	if client == nil {
+		client = &http.Client{Timeout: 3 * time.Second}
+	}
+	return &httpRegistry{base: strings.TrimSuffix(base, "/"), client: client}
+}
+
+func (r *httpRegistry) Resolve(ctx context.Context, service string) ([]Instance, error) {
+	data, err := r.do(ctx, http.MethodGet, r.serviceUrl(service), nil)
+	if err != nil {
+		return nil, err
+	}
+	var instances []Instance
+	if err = json.Unmarshal(data, &instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (r *httpRegistry) Register(ctx context.Context, service string, instance Instance) error {
+	body, err := json.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	_, err = r.do(ctx, http.MethodPut, r.serviceUrl(service), body)
+	return err
+}
+
+func (r *httpRegistry) Deregister(ctx context.Context, service string, instance Instance) error {
+	_, err := r.do(ctx, http.MethodDelete, r.serviceUrl(service)+"?address="+url.QueryEscape(instance.Address), nil)
+	return err
+}
+
+func (r *httpRegistry) serviceUrl(service string) string {
+	return r.base + "/services/" + url.PathEscape(service)
+}
+
+func (r *httpRegistry) do(ctx context.Context, method string, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, errors.New(method + " " + url + " status error:" + resp.Status)
+	}
+	return data, nil
+}
+
+// registryServer 内存中的注册中心, 实现上述 HTTP 协议, 用于测试与小规模部署; 超过 ttl 未续约的实例被移除
+type registryServer struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	services map[string]map[string]*registryEntry
+}
+
+type registryEntry struct {
+	instance Instance
+	expireAt time.Time
+}
+
+// NewRegistryServer ttl 为 0 时实例不过期
+func NewRegistryServer(ttl time.Duration) http.Handler {
+	return &registryServer{ttl: ttl, services: make(map[string]map[string]*registryEntry)}
+}
+
+func (s *registryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service, ok := strings.CutPrefix(r.URL.Path, "/services/")
+	if !ok || service == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		var now = time.Now()
+		var instances = make([]Instance, 0, len(s.services[service]))
+		for address, entry := range s.services[service] {
+			if s.ttl > 0 && now.After(entry.expireAt) {
+				delete(s.services[service], address)
+				continue
+			}
+			instances = append(instances, entry.instance)
+		}
+		sortInstances(instances)
+		data, _ := json.Marshal(instances)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case http.MethodPut, http.MethodPost:
+		var instance Instance
+		data, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(data, &instance)
+		}
+		if err != nil || instance.Address == "" {
+			http.Error(w, "invalid instance", http.StatusBadRequest)
+			return
+		}
+		if s.services[service] == nil {
+			s.services[service] = make(map[string]*registryEntry)
+		}
+		s.services[service][instance.Address] = &registryEntry{instance: instance, expireAt: time.Now().Add(s.ttl)}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.services[service], r.URL.Query().Get("address"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -16,6 +16,7 @@ var apiTemplate = `
 # {{name}}
 
 > 接口描述 {{desc}}
+{{routes}}
 ## 请求参数
 
 | 参数名称 | 类型 | 必填 | 描述 | 默认 |
@@ -45,10 +46,22 @@ func GenMdDocs(path string, is ...play.IServer) (err error) {
 			_ = f.Close()
 		}()
 
-		// step 2. 获取内容
+		// step 2. 获取内容, 路由表包含代码注册的路由
+		var routes map[string][]play.Route
+		if r, ok := i.(interface{ Routes() []play.Route }); ok {
+			routes = make(map[string][]play.Route)
+			for _, route := range r.Routes() {
+				routes[route.Action] = append(routes[route.Action], route)
+			}
+		}
 		names := i.ActionUnitNames()
 		for _, name := range names {
-			toc, api := getMdActionTpl(i.LookupActionUnit(name))
+			unit := i.LookupActionUnit(name)
+			actionRoutes := unit.Routes
+			if routes != nil {
+				actionRoutes = routes[name]
+			}
+			toc, api := getMdActionTpl(unit, actionRoutes)
 			mktoc += toc
 			mkapi += api
 		}
@@ -61,13 +74,14 @@ func GenMdDocs(path string, is ...play.IServer) (err error) {
 	return
 }
 
-func getMdActionTpl(action *play.ActionUnit) (toc, api string) {
+func getMdActionTpl(action *play.ActionUnit, routes []play.Route) (toc, api string) {
 	var tmp = apiTemplate
 	var tocTmp = tocTemplate
 	tocTmp = strings.ReplaceAll(tocTmp, "{{title}}", action.RequestName)
 	tocTmp = strings.ReplaceAll(tocTmp, "{{link}}", action.RequestName)
 	tmp = strings.ReplaceAll(tmp, "{{name}}", action.RequestName)
 	tmp = strings.ReplaceAll(tmp, "{{desc}}", action.Action.MetaData()["desc"])
+	tmp = strings.ReplaceAll(tmp, "{{routes}}", getMdRoutesTpl(routes))
 	tmp = strings.ReplaceAll(tmp, "{{request}}", getMdFieldTplInput(action.Action.Input(), 0))
 	tmp = strings.ReplaceAll(tmp, "{{response}}", getMdFieldTplOutput(action.Action.Output(), 0))
 	tmp = strings.ReplaceAll(tmp, "{{example}}", "```json\n"+action.Action.Example()+"\n```")
@@ -75,6 +89,18 @@ func getMdActionTpl(action *play.ActionUnit) (toc, api string) {
 	return tocTmp, tmp
 }
 
+func getMdRoutesTpl(routes []play.Route) string {
+	var tmp string
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = "ANY"
+		}
+		tmp += fmt.Sprintf("\n> 路由 `%s %s`\n", method, route.Pattern)
+	}
+	return tmp
+}
+
 func getMdFieldTplInput(fields map[string]play.ActionField, level int) string {
 	var tmp string
 	var names []string
@@ -45,7 +45,7 @@ type {{responseName}} struct {
 func {{callAction}}(ctx context.Context, agent play.Agent, req {{requestName}}) (resp {{responseName}}, err error) {
 	var service, action = "{{moduleName}}", "{{actionName}}"
 	var sendData, recvData []byte
-
+{{idempotent}}
 	if sendData, err = agent.Marshal(ctx, service, action, req); err != nil {
 		return
 	}
@@ -114,6 +114,11 @@ func getSdkActionTpl(moduleName string, unit *play.ActionUnit) (err error) {
 	tmp = strings.ReplaceAll(tmp, "{{desc}}", unit.Action.MetaData()["desc"])
 	tmp = strings.ReplaceAll(tmp, "{{actionName}}", unit.RequestName)
 	tmp = strings.ReplaceAll(tmp, "{{callAction}}", callAction)
+	if unit.Action.MetaData()["idempotent"] == "true" {
+		tmp = strings.ReplaceAll(tmp, "{{idempotent}}", "\tctx = play.WithIdempotent(ctx)\n")
+	} else {
+		tmp = strings.ReplaceAll(tmp, "{{idempotent}}", "")
+	}
 	tmp = strings.ReplaceAll(tmp, "{{requestFields}}", getSdkFieldTpl(unit.Action.Input(), requestAction, actionSpecialFields))
 	tmp = strings.ReplaceAll(tmp, "{{responseFields}}", getSdkFieldTpl(unit.Action.Output(), requestAction, actionSpecialFields))
 	tmp = strings.ReplaceAll(tmp, "{{specialFields}}", getSpecialFields(actionSpecialFields))
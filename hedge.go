@@ -0,0 +1,254 @@
+package play
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+type idempotentCtx struct{}
+type triedHostsCtx struct{}
+
+// WithIdempotent 标记本次调用的 action 是幂等的, 允许对冲请求; 生成的 SDK 对 DSL 中 @idempotent: true 的 action 自动标记
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentCtx{}, true)
+}
+
+func IsIdempotent(ctx context.Context) bool {
+	v, _ := ctx.Value(idempotentCtx{}).(bool)
+	return v
+}
+
+// triedHosts 一次对冲调用中已选择过的服务器, HostGroup 与 GroupSocket 据此把重复请求发往其他服务器
+type triedHosts struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (t *triedHosts) add(host string) {
+	t.mu.Lock()
+	t.hosts = append(t.hosts, host)
+	t.mu.Unlock()
+}
+
+func (t *triedHosts) filter(hosts []*BalanceHost) []*BalanceHost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var untried = make([]*BalanceHost, 0, len(hosts))
+	for _, h := range hosts {
+		if !slices.Contains(t.hosts, h.Host) {
+			untried = append(untried, h)
+		}
+	}
+	return untried
+}
+
+// pickUntried 按策略选择服务器, 对冲请求优先选择本次调用尚未使用的服务器
+func pickUntried(ctx context.Context, balancer Balancer, hosts []*BalanceHost) *BalanceHost {
+	tried, _ := ctx.Value(triedHostsCtx{}).(*triedHosts)
+	if tried != nil {
+		if untried := tried.filter(hosts); len(untried) > 0 {
+			hosts = untried
+		}
+	}
+	h := balancer.Pick(hosts, BalanceKeyOf(ctx))
+	if tried != nil {
+		tried.add(h.Host)
+	}
+	return h
+}
+
+// hedgedAgent 对幂等 action 发出请求后, 超过延迟仍未返回时向另一台服务器发送重复请求, 使用最先成功的响应并取消其余请求
+type hedgedAgent struct {
+	Agent
+	delay       time.Duration
+	percentile  float64
+	maxAttempts int
+	retryOnErr  bool
+	mu          sync.Mutex
+	idempotent  map[string]bool
+	latency     map[string]*latencyWindow
+}
+
+type hedgeResult struct {
+	attempt int
+	data    []byte
+	err     error
+}
+
+// NewHedgedAgent 包装 agent, 默认延迟 50ms 后发出第二个请求, 最多2个
+func NewHedgedAgent(agent Agent) *hedgedAgent {
+	return &hedgedAgent{
+		Agent:       agent,
+		delay:       50 * time.Millisecond,
+		maxAttempts: 2,
+		idempotent:  make(map[string]bool),
+		latency:     make(map[string]*latencyWindow),
+	}
+}
+
+// WithDelay 固定的对冲延迟, 设置了分位数但样本不足时也使用该值
+func (a *hedgedAgent) WithDelay(delay time.Duration) *hedgedAgent {
+	a.delay = delay
+	return a
+}
+
+// WithPercentile 以观测到的该 action 请求延迟的分位数(如 0.95)作为对冲延迟, 每个请求(包括被取消的)都计入
+func (a *hedgedAgent) WithPercentile(percentile float64) *hedgedAgent {
+	a.percentile = percentile
+	return a
+}
+
+// WithMaxAttempts 包括首次请求在内的最大请求数
+func (a *hedgedAgent) WithMaxAttempts(n int) *hedgedAgent {
+	a.maxAttempts = max(n, 1)
+	return a
+}
+
+// WithRetryOnError 幂等请求失败时不等待对冲延迟, 立即向其他服务器重发, 直到达到最大请求数; 默认不重发
+func (a *hedgedAgent) WithRetryOnError(retry bool) *hedgedAgent {
+	a.retryOnErr = retry
+	return a
+}
+
+// WithIdempotentActions 声明服务的幂等 action, 未通过 WithIdempotent 标记的调用也会对冲
+func (a *hedgedAgent) WithIdempotentActions(service string, actions ...string) *hedgedAgent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, action := range actions {
+		a.idempotent[service+"/"+action] = true
+	}
+	return a
+}
+
+// Request 非幂等 action 直接请求; 幂等 action 超过对冲延迟未返回时向其他服务器发送重复请求, 全部失败时返回最后一个错误
+func (a *hedgedAgent) Request(ctx context.Context, service string, action string, body []byte) ([]byte, error) {
+	var key = service + "/" + action
+	a.mu.Lock()
+	idempotent := a.idempotent[key]
+	a.mu.Unlock()
+	if a.maxAttempts <= 1 || !(idempotent || IsIdempotent(ctx)) {
+		return a.Agent.Request(ctx, service, action, body)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, triedHostsCtx{}, &triedHosts{}))
+	defer cancel()
+
+	var results = make(chan hedgeResult, a.maxAttempts)
+	var starts = make([]time.Time, 0, a.maxAttempts)
+	var finished = make([]bool, a.maxAttempts)
+	var pending int
+	var send = func() {
+		pending++
+		starts = append(starts, time.Now())
+		go func(attempt int) {
+			data, err := a.Agent.Request(ctx, service, action, body)
+			results <- hedgeResult{attempt: attempt, data: data, err: err}
+		}(len(starts) - 1)
+	}
+	// 返回时仍未完成的请求以已等待的时间计入延迟, 避免只统计较快的请求使分位数偏低
+	defer func() {
+		now := time.Now()
+		for k, start := range starts {
+			if !finished[k] {
+				a.observe(key, now.Sub(start))
+			}
+		}
+	}()
+
+	var delay = a.hedgeDelay(key)
+	var timer = time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	for send(); pending > 0; {
+		select {
+		case r := <-results:
+			pending--
+			finished[r.attempt] = true
+			a.observe(key, time.Since(starts[r.attempt]))
+			if r.err == nil {
+				return r.data, nil
+			}
+			err = r.err
+			if a.retryOnErr && len(starts) < a.maxAttempts && ctx.Err() == nil {
+				send()
+			}
+		case <-timer.C:
+			if len(starts) < a.maxAttempts {
+				send()
+				timer.Reset(delay)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+func (a *hedgedAgent) hedgeDelay(key string) time.Duration {
+	if a.percentile <= 0 {
+		return a.delay
+	}
+	a.mu.Lock()
+	w := a.latency[key]
+	a.mu.Unlock()
+	if d, ok := w.percentileOf(a.percentile); ok {
+		return d
+	}
+	return a.delay
+}
+
+func (a *hedgedAgent) observe(key string, elapsed time.Duration) {
+	if a.percentile <= 0 {
+		return
+	}
+	a.mu.Lock()
+	w := a.latency[key]
+	if w == nil {
+		w = &latencyWindow{}
+		a.latency[key] = w
+	}
+	a.mu.Unlock()
+	w.add(elapsed)
+}
+
+// latencyWindow 最近 latencyWindowSize 次请求的延迟
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+const latencyWindowSize = 256
+const latencyMinSamples = 20
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// percentileOf 样本少于 latencyMinSamples 时返回 false
+func (w *latencyWindow) percentileOf(p float64) (time.Duration, bool) {
+	if w == nil {
+		return 0, false
+	}
+	w.mu.Lock()
+	if len(w.samples) < latencyMinSamples {
+		w.mu.Unlock()
+		return 0, false
+	}
+	samples := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	slices.Sort(samples)
+	index := int(float64(len(samples)-1) * min(p, 1))
+	return samples[index], true
+}
@@ -10,8 +10,9 @@ import (
 )
 
 type Input struct {
-	binder   binders.Binder
-	exValues sync.Map
+	binder      binders.Binder
+	exValues    sync.Map
+	attachments map[string][]byte
 }
 
 func NewInput(binder binders.Binder) Input {
@@ -26,6 +27,16 @@ func (input *Input) SetBinder(binder binders.Binder) {
 	input.binder = binder
 }
 
+// Attachment 返回请求携带的附件, 不存在时返回 nil
+func (input *Input) Attachment(key string) []byte {
+	return input.attachments[key]
+}
+
+// Attachments 返回请求携带的全部附件
+func (input *Input) Attachments() map[string][]byte {
+	return input.attachments
+}
+
 func (input *Input) SetValue(key string, val interface{}) {
 	input.exValues.Store(key, val)
 }
@@ -0,0 +1,89 @@
+package packers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/codec/binders"
+	"github.com/leochen2038/play/codec/renders"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GrpcTraceKey 请求与响应中携带 trace id 的 metadata 键
+const GrpcTraceKey = "x-trace-id"
+
+// GrpcConn gRPC 调用的状态, 保存在 play.Conn.Grpc 中
+type GrpcConn struct {
+	Stream grpc.ServerStream
+	Method protoreflect.MethodDescriptor
+	Action string
+	Sent   bool  // 已发送过响应消息
+	Error  error // 响应中的错误, 由实例在调用结束时转换为 gRPC 状态
+}
+
+type GrpcPacker struct{}
+
+// NewGrpcPacker gRPC 实例使用的 packer, 按方法的输入消息绑定参数, 按输出消息渲染 Output
+func NewGrpcPacker() play.IPacker {
+	return &GrpcPacker{}
+}
+
+func (p *GrpcPacker) Unpack(c *play.Conn) (*play.Request, error) {
+	g, ok := c.Grpc.(*GrpcConn)
+	if c.Type != play.SERVER_TYPE_GRPC || !ok {
+		return nil, errors.New("grpc packer not support " + strconv.Itoa(c.Type) + " type")
+	}
+
+	msg := dynamicpb.NewMessage(g.Method.Input())
+	if err := g.Stream.RecvMsg(msg); err != nil {
+		return nil, err
+	}
+
+	ctx := g.Stream.Context()
+	request := &play.Request{RenderName: "protobuf", ActionName: g.Action, InputBinder: binders.GetBinderOfProtobuf(msg.ProtoReflect())}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(GrpcTraceKey); len(v) > 0 {
+			request.TraceId = v[0]
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		request.Deadline = deadline
+	}
+	return request, nil
+}
+
+// Pack 错误记录在 Conn 中由实例转换为状态返回; 服务端流式方法中 Output 为空的最终响应不发送
+func (p *GrpcPacker) Pack(c *play.Conn, res *play.Response) ([]byte, error) {
+	if res == nil {
+		return nil, ErrNilResponse
+	}
+	g, ok := c.Grpc.(*GrpcConn)
+	if !ok {
+		return nil, errors.New("grpc packer not support " + strconv.Itoa(c.Type) + " type")
+	}
+	if res.TraceId != "" {
+		_ = g.Stream.SetHeader(metadata.Pairs(GrpcTraceKey, res.TraceId))
+	}
+	if res.Error != nil {
+		g.Error = res.Error
+		return nil, nil
+	}
+	if g.Method.IsStreamingServer() && len(res.Output.All()) == 0 {
+		return nil, nil
+	}
+
+	data, err := renders.GetRenderOfProtobuf(g.Method.Output()).Render(res.Output.All())
+	if err != nil {
+		g.Error = err
+		return nil, err
+	}
+	if len(data) == 0 {
+		// 空消息编码后长度为0, 由实例在调用结束时补发
+		return nil, nil
+	}
+	return data, nil
+}
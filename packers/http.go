@@ -5,10 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/leochen2038/play/codec/compressors"
 	"github.com/leochen2038/play/codec/protos/golang/json"
 	"github.com/leochen2038/play/codec/renders"
 
@@ -23,9 +29,12 @@ const (
 )
 
 var (
-	ErrUndefinedFilePath = errors.New("undefined file path")
-	ErrUndefinedPath     = errors.New("undefined path")
-	ErrUndefinedRender   = errors.New("undefined http response render")
+	ErrUndefinedFilePath     = errors.New("undefined file path")
+	ErrUndefinedPath         = errors.New("undefined path")
+	ErrUndefinedRender       = errors.New("undefined http response render")
+	ErrRequestEntityTooLarge = errors.New("request entity too large")
+	ErrMethodNotAllowed      = errors.New("method not allowed")
+	ErrInvalidRequestBody    = errors.New("invalid request body")
 )
 
 // MIME 类型映射
@@ -33,7 +42,21 @@ var contentTypeMap = map[string]string{
 	"html": "text/html; charset=utf-8",
 	"js":   "text/javascript; charset=utf-8",
 	"css":  "text/css; charset=utf-8",
-	"json": "application/json; charset=utf-8",
+}
+
+// staticExtensions 按 mime 类型从 TemplateRoot 直接输出的扩展名, 其余扩展名不作为文件返回, 避免暴露目录中的源码、配置等文件
+var staticExtensions = map[string]bool{
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "webp": true, "avif": true, "svg": true, "ico": true,
+	"woff": true, "woff2": true, "ttf": true, "otf": true,
+	"mp3": true, "mp4": true, "webm": true, "ogg": true, "wav": true,
+	"pdf": true, "txt": true, "map": true, "wasm": true,
+}
+
+// AllowStaticExtension 允许按 mime 类型输出其它扩展名的静态文件, 在服务启动前调用
+func AllowStaticExtension(exts ...string) {
+	for _, ext := range exts {
+		staticExtensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+	}
 }
 
 type HttpPacker struct {
@@ -44,21 +67,120 @@ func NewHttpPacker() play.IPacker {
 }
 
 func (p *HttpPacker) Unpack(c *play.Conn) (*play.Request, error) {
+	var err error
+	var params map[string]string
 	var request = new(play.Request)
-	request.ActionName, request.RenderName = p.ParseHttpPath(c.Http.Request.URL.Path)
-	request.InputBinder = p.ParseHttpInput(c.Http.Request)
+	if request.ActionName, request.RenderName, params, err = p.RouteHttpRequest(c); err != nil {
+		return nil, err
+	}
+	if request.InputBinder, err = p.ParseHttpInputWithPolicy(c.Http.Request, p.BodyPolicy(c, request.ActionName)); err != nil {
+		if errors.Is(err, ErrRequestEntityTooLarge) {
+			c.Http.ResponseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else if errors.Is(err, ErrInvalidRequestBody) {
+			c.Http.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	request.InputBinder = binders.GetBinderOfPath(params, request.InputBinder)
 	return request, nil
 }
 
+// RouteHttpRequest 按路由表解析action和路径参数, 未命中路由时按路径映射action
+// 路径匹配但方法不允许时写入 405 (OPTIONS 请求为 204) 及 Allow 头, 返回 ErrMethodNotAllowed
+func (p *HttpPacker) RouteHttpRequest(c *play.Conn) (action, render string, params map[string]string, err error) {
+	r := c.Http.Request
+	if c.Http.Router != nil {
+		var allow []string
+		if action, params, allow = c.Http.Router.Match(r.Method, r.URL.Path); action != "" {
+			return action, p.acceptRender(c), params, nil
+		}
+		if len(allow) > 0 {
+			c.Http.ResponseWriter.Header().Set("Allow", strings.Join(allow, ", "))
+			if r.Method == http.MethodOptions {
+				c.Http.ResponseWriter.WriteHeader(http.StatusNoContent)
+			} else {
+				c.Http.ResponseWriter.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return "", "", nil, fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, r.Method, r.URL.Path)
+		}
+	}
+	if action, render = p.ParseHttpPath(r.URL.Path); strings.IndexByte(r.URL.Path, '.') <= 0 {
+		render = p.acceptRender(c)
+	}
+	return action, render, nil, nil
+}
+
+// acceptRender URL 未指定扩展名时按 Accept 头协商render, 无可用格式时使用默认render
+func (p *HttpPacker) acceptRender(c *play.Conn) string {
+	if c.Type == play.SERVER_TYPE_SSE || c.Type == play.SERVER_TYPE_WS {
+		// 事件流和websocket的 Accept 不描述消息格式
+		return defaultRender
+	}
+	if render := renders.Negotiate(c.Http.Request.Header.Get("Accept"), defaultRender); render != "" {
+		return render
+	}
+	return defaultRender
+}
+
+// BodyPolicy 获取action对应的请求体读取策略
+func (p *HttpPacker) BodyPolicy(c *play.Conn, action string) (policy play.BodyPolicy) {
+	if c.Http.BodyPolicy != nil {
+		policy = c.Http.BodyPolicy(action)
+	}
+	if policy.MaxMemory <= 0 {
+		policy.MaxMemory = defaultFormSize
+	}
+	return
+}
+
 func (p *HttpPacker) Pack(c *play.Conn, res *play.Response) ([]byte, error) {
+	if res.Body != nil {
+		return nil, serveBody(c, res)
+	}
+	data, err := p.pack(c, res)
+	if err != nil {
+		return nil, err
+	}
+	// SSE 为流式输出, 由实例对整个事件流压缩
+	if c.Type == play.SERVER_TYPE_SSE {
+		writeHttpResponseMeta(c, res)
+		return packServerEvent(res, data), nil
+	}
+	if data, err = compressHttpBody(c, data); err != nil {
+		return nil, err
+	}
+	writeHttpResponseMeta(c, res)
+	return data, nil
+}
+
+// writeHttpResponseMeta 写入 Response 中的状态码、响应头和cookie, 响应头只在首次写出前生效
+func writeHttpResponseMeta(c *play.Conn, res *play.Response) {
+	if c.Http.HeaderWritten {
+		return
+	}
+	c.Http.HeaderWritten = true
+
+	w := c.Http.ResponseWriter
+	for key, values := range res.Header {
+		w.Header()[key] = values
+	}
+	for _, cookie := range res.Cookies {
+		http.SetCookie(w, cookie)
+	}
+	if res.Status > 0 {
+		w.WriteHeader(res.Status)
+	}
+}
+
+func (p *HttpPacker) pack(c *play.Conn, res *play.Response) ([]byte, error) {
 	// 设置通用 header
 	header := c.Http.ResponseWriter.Header()
 
-	// JSON 处理
-	if res.RenderName == "json" {
-		header.Set("Content-Type", contentTypeMap["json"])
-		header.Set("Cache-Control", "no-cache, must-revalidate, max-age=0")
-		return renders.GetRenderOfJson().Render(res.Output.All())
+	// 已注册模板的 html 页面由 html/template 渲染
+	if res.RenderName == "html" {
+		if t := renders.LookupTemplate(res.TemplateRoot); t != nil {
+			return p.handleTemplate(c, t, res)
+		}
 	}
 
 	// 静态文件处理
@@ -67,37 +189,165 @@ func (p *HttpPacker) Pack(c *play.Conn, res *play.Response) ([]byte, error) {
 		return p.handleStaticFile(c, res)
 	}
 
+	// 已注册的 render (json/xml/yaml/msgpack/csv 及自定义)
+	if render := renders.Get(res.RenderName); render != nil {
+		header.Set("Content-Type", renders.ContentType(res.RenderName))
+		header.Set("Cache-Control", "no-cache, must-revalidate, max-age=0")
+		return render.Render(res.Output.All())
+	}
+
+	// 允许的静态资源扩展名按 mime 类型作为静态文件处理
+	if contentType := mime.TypeByExtension("." + res.RenderName); contentType != "" && staticExtensions[res.RenderName] {
+		header.Set("Content-Type", contentType)
+		return p.handleStaticFile(c, res)
+	}
+
+	c.Http.ResponseWriter.WriteHeader(http.StatusNotAcceptable)
 	return nil, fmt.Errorf("%w: %s", ErrUndefinedRender, res.RenderName)
 }
 
+// compressHttpBody 按请求的 Accept-Encoding 压缩响应体并设置 Content-Encoding
+func compressHttpBody(c *play.Conn, data []byte) ([]byte, error) {
+	if c.Compress == nil || len(data) == 0 {
+		return data, nil
+	}
+	header := c.Http.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		return data, nil
+	}
+	header.Add("Vary", "Accept-Encoding")
+
+	body, encoding, err := compressors.NegotiateCompress(data, c.Http.Request.Header.Get("Accept-Encoding"), c.Compress.MinSize, c.Compress.Encodings)
+	if err != nil {
+		return nil, err
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		header.Del("Content-Length")
+	}
+	return body, nil
+}
+
 func (p *HttpPacker) handleStaticFile(c *play.Conn, res *play.Response) ([]byte, error) {
 	if res.TemplateRoot == "" {
 		c.Http.ResponseWriter.WriteHeader(http.StatusNotFound)
 		return nil, ErrUndefinedFilePath
 	}
 
-	// 使用 strings.Builder 优化字符串拼接
-	var sb strings.Builder
-	sb.Grow(len(res.TemplateRoot) + len(res.Template) + len(res.RenderName) + 2)
-	sb.WriteString(strings.TrimRight(res.TemplateRoot, "/"))
-	sb.WriteByte('/')
-	sb.WriteString(res.Template)
-	sb.WriteByte('.')
-	sb.WriteString(res.RenderName)
-
-	content, err := os.ReadFile(sb.String())
+	// 防止路径穿越到 TemplateRoot 之外
+	root := filepath.Clean(res.TemplateRoot)
+	name := filepath.Join(root, filepath.FromSlash(res.Template)+"."+res.RenderName)
+	if rel, err := filepath.Rel(root, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		c.Http.ResponseWriter.WriteHeader(http.StatusNotFound)
+		return nil, fmt.Errorf("%w: %s", ErrUndefinedPath, c.Http.Request.URL.Path)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() {
+		c.Http.ResponseWriter.WriteHeader(http.StatusNotFound)
+		return nil, fmt.Errorf("%w: %s", ErrUndefinedPath, c.Http.Request.URL.Path)
+	}
+
+	// 注入了 Output 的页面内容随请求变化, 不做协商缓存
+	inject := res.RenderName == "html" && len(res.Output.All()) > 0
+	if !inject && checkNotModified(c, fileETag(info.Size(), info.ModTime()), info.ModTime()) {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(name)
 	if err != nil {
 		c.Http.ResponseWriter.WriteHeader(http.StatusNotFound)
 		return nil, fmt.Errorf("%w: %s", ErrUndefinedPath, c.Http.Request.URL.Path)
 	}
 
-	if res.RenderName == "html" && len(res.Output.All()) > 0 {
+	if inject {
 		return p.injectHtmlData(content, res)
 	}
 
 	return content, nil
 }
 
+// checkNotModified 写入 ETag / Last-Modified, 命中条件请求时写入 304
+func checkNotModified(c *play.Conn, etag string, modTime time.Time) bool {
+	w, r := c.Http.ResponseWriter, c.Http.Request
+	w.Header().Set("ETag", etag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	notModified := false
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, v := range strings.Split(match, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+				notModified = true
+			}
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modTime.IsZero() {
+		notModified = !modTime.Truncate(time.Second).After(since)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		c.Http.HeaderWritten = true
+	}
+	return notModified
+}
+
+func fileETag(size int64, modTime time.Time) string {
+	return `W/"` + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modTime.UnixNano(), 16) + `"`
+}
+
+// ServeContent 输出可定位的内容, 支持 Range 及条件请求; 未设置 ETag 且 modTime 非零时按大小和修改时间生成
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, size int64, content io.ReadSeeker) {
+	if w.Header().Get("ETag") == "" && !modTime.IsZero() {
+		w.Header().Set("ETag", fileETag(size, modTime))
+	}
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// serveBody 输出 Response.Body, 设置了状态码或内容不可定位时直接复制
+func serveBody(c *play.Conn, res *play.Response) error {
+	body := res.Body
+	if closer, ok := body.Reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	header := c.Http.ResponseWriter.Header()
+	if body.ContentType != "" {
+		header.Set("Content-Type", body.ContentType)
+	} else if contentType := mime.TypeByExtension(filepath.Ext(body.Name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if body.Attachment {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": body.Name}))
+	}
+
+	if rs, ok := body.Reader.(io.ReadSeeker); ok && res.Status == 0 {
+		writeHttpResponseMeta(c, res)
+		ServeContent(c.Http.ResponseWriter, c.Http.Request, body.Name, body.ModTime, body.Size, rs)
+		return nil
+	}
+	if body.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(body.Size, 10))
+	}
+	writeHttpResponseMeta(c, res)
+	_, err := io.Copy(c.Http.ResponseWriter, body.Reader)
+	return err
+}
+
+func (p *HttpPacker) handleTemplate(c *play.Conn, t *renders.TemplateRender, res *play.Response) ([]byte, error) {
+	data, err := t.Render(res.Template, res.Output.All())
+	if err != nil {
+		if errors.Is(err, renders.ErrTemplateNotFound) {
+			c.Http.ResponseWriter.WriteHeader(http.StatusNotFound)
+		} else {
+			c.Http.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		}
+		return nil, err
+	}
+	c.Http.ResponseWriter.Header().Set("Content-Type", contentTypeMap["html"])
+	return data, nil
+}
+
 func (p *HttpPacker) injectHtmlData(content []byte, res *play.Response) ([]byte, error) {
 	outputData, err := json.MarshalEscape(res.Output.All(), false, false)
 	if err != nil {
@@ -151,23 +401,68 @@ func (p *HttpPacker) ParseHttpPath(path string) (action, render string) {
 }
 
 func (p *HttpPacker) ParseHttpInput(request *http.Request) binders.Binder {
+	binder, _ := p.ParseHttpInputWithPolicy(request, play.BodyPolicy{MaxMemory: defaultFormSize})
+	return binder
+}
+
+// ParseHttpInputWithPolicy 按读取策略解析请求参数, 请求体超出限制时返回 ErrRequestEntityTooLarge
+func (p *HttpPacker) ParseHttpInputWithPolicy(request *http.Request, policy play.BodyPolicy) (binders.Binder, error) {
+	var limiter *bodyLimiter
 	contentType := request.Header.Get("Content-Type")
 
+	if policy.MaxSize > 0 && request.Body != nil && request.Body != http.NoBody {
+		if request.ContentLength > policy.MaxSize {
+			return nil, ErrRequestEntityTooLarge
+		}
+		limiter = &bodyLimiter{ReadCloser: request.Body, remain: policy.MaxSize}
+		request.Body = limiter
+	}
+
+	binder, err := p.parseHttpInput(request, contentType, policy)
+	if limiter != nil && limiter.exceeded {
+		return nil, ErrRequestEntityTooLarge
+	}
+	return binder, err
+}
+
+func (p *HttpPacker) parseHttpInput(request *http.Request, contentType string, policy play.BodyPolicy) (binders.Binder, error) {
+	if decoder := binders.LookupBodyDecoder(contentType); decoder != nil {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		request.Body = io.NopCloser(bytes.NewReader(body))
+
+		binder, err := decoder(body, request)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequestBody, err)
+		}
+		return binder, nil
+	}
+
 	switch {
 	case strings.Contains(contentType, "/json"),
+		strings.Contains(contentType, "+json"),
 		strings.Contains(contentType, "/bytes"):
-		return p.handleBodyContent(request, contentType)
+		return p.handleBodyContent(request, contentType), nil
 
 	case strings.Contains(contentType, "/x-www-form-urlencoded"):
 		_ = request.ParseForm()
-		return binders.GetBinderOfUrlValue(request.Form, nil)
+		return binders.GetBinderOfUrlValue(request.Form, nil), nil
 
 	case strings.Contains(contentType, "/form-data"):
-		_ = request.ParseMultipartForm(defaultFormSize)
-		return binders.GetBinderOfUrlValue(request.Form, request.MultipartForm.File)
+		var files map[string][]*multipart.FileHeader
+		if err := request.ParseMultipartForm(policy.MaxMemory); err == nil {
+			files = request.MultipartForm.File
+		}
+		if policy.StreamUpload {
+			return binders.GetBinderOfUrlValueStream(request.Form, files), nil
+		}
+		return binders.GetBinderOfUrlValue(request.Form, files), nil
 	}
 
-	return binders.GetBinderOfUrlValue(request.URL.Query(), nil)
+	return binders.GetBinderOfUrlValue(request.URL.Query(), nil), nil
 }
 
 func (p *HttpPacker) handleBodyContent(request *http.Request, contentType string) binders.Binder {
@@ -183,8 +478,36 @@ func (p *HttpPacker) handleBodyContent(request *http.Request, contentType string
 	// 重新设置请求体
 	request.Body = io.NopCloser(buf)
 
-	if strings.Contains(contentType, "/json") {
+	if strings.Contains(contentType, "json") {
 		return binders.GetBinderOfJson(buf.Bytes())
 	}
 	return binders.GetBinderOfBytes(buf.Bytes())
 }
+
+// bodyLimiter 限制请求体的读取字节数, 超出时标记 exceeded 并返回 ErrRequestEntityTooLarge
+type bodyLimiter struct {
+	io.ReadCloser
+	remain   int64
+	exceeded bool
+}
+
+func (l *bodyLimiter) Read(b []byte) (n int, err error) {
+	if l.exceeded {
+		return 0, ErrRequestEntityTooLarge
+	}
+	if l.remain <= 0 {
+		// 已读满上限, 探测是否还有剩余数据
+		var probe [1]byte
+		if n, err = l.ReadCloser.Read(probe[:]); n > 0 {
+			l.exceeded = true
+			return 0, ErrRequestEntityTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(b)) > l.remain {
+		b = b[:l.remain]
+	}
+	n, err = l.ReadCloser.Read(b)
+	l.remain -= int64(n)
+	return
+}
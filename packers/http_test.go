@@ -0,0 +1,129 @@
+package packers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/leochen2038/play"
+)
+
+func TestBodyLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		oneByte bool
+		wantErr error
+	}{
+		{name: "under limit", size: 10, limit: 16},
+		{name: "exact limit", size: 16, limit: 16},
+		{name: "exact limit one byte reads", size: 16, limit: 16, oneByte: true},
+		{name: "one byte over", size: 17, limit: 16, wantErr: ErrRequestEntityTooLarge},
+		{name: "far over", size: 4096, limit: 16, wantErr: ErrRequestEntityTooLarge},
+		{name: "over one byte reads", size: 17, limit: 16, oneByte: true, wantErr: ErrRequestEntityTooLarge},
+		{name: "empty", size: 0, limit: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r io.Reader = bytes.NewReader(bytes.Repeat([]byte{'a'}, tt.size))
+			if tt.oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			l := &bodyLimiter{ReadCloser: io.NopCloser(r), remain: tt.limit}
+			data, err := io.ReadAll(l)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if l.exceeded != (tt.wantErr != nil) {
+				t.Fatalf("exceeded = %v", l.exceeded)
+			}
+			if int64(len(data)) > tt.limit {
+				t.Fatalf("read %d bytes over limit %d", len(data), tt.limit)
+			}
+			if tt.wantErr == nil && len(data) != tt.size {
+				t.Fatalf("read %d bytes, want %d", len(data), tt.size)
+			}
+			// 超出后继续读取仍返回错误
+			if tt.wantErr != nil {
+				if n, err := l.Read(make([]byte, 8)); n != 0 || !errors.Is(err, ErrRequestEntityTooLarge) {
+					t.Fatalf("read after exceeded: n = %d, err = %v", n, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHttpInputWithPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		chunked     bool // 不携带 Content-Length, 只能在读取时发现超限
+		maxSize     int64
+		wantErr     error
+	}{
+		{name: "json", contentType: "application/json", body: `{"name":"play"}`, maxSize: 64},
+		{name: "json too large", contentType: "application/json", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, maxSize: 64, wantErr: ErrRequestEntityTooLarge},
+		{name: "json chunked too large", contentType: "application/json", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, chunked: true, maxSize: 64, wantErr: ErrRequestEntityTooLarge},
+		{name: "form chunked too large", contentType: "application/x-www-form-urlencoded", body: "name=" + strings.Repeat("a", 64), chunked: true, maxSize: 64, wantErr: ErrRequestEntityTooLarge},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "name=play", chunked: true, maxSize: 64},
+		{name: "unlimited", contentType: "application/json", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, chunked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/user/get", strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			if tt.chunked {
+				request.ContentLength = -1
+				request.Body = io.NopCloser(iotest.HalfReader(strings.NewReader(tt.body)))
+			}
+			binder, err := new(HttpPacker).ParseHttpInputWithPolicy(request, play.BodyPolicy{MaxSize: tt.maxSize, MaxMemory: defaultFormSize})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && binder == nil {
+				t.Fatal("binder is nil")
+			}
+		})
+	}
+}
+
+func TestRouteHttpRequestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		want   string
+	}{
+		{name: "extension", path: "/user/list.xml", accept: "application/json", want: "xml"},
+		{name: "accept", path: "/user/list", accept: "application/yaml", want: "yaml"},
+		{name: "no accept", path: "/user/list", want: "json"},
+		{name: "unsupported accept", path: "/user/list", accept: "text/html", want: "json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Header.Set("Accept", tt.accept)
+			recorder := httptest.NewRecorder()
+			c := &play.Conn{Type: play.SERVER_TYPE_HTTP}
+			c.Http.Request, c.Http.ResponseWriter = request, recorder
+
+			action, render, _, err := new(HttpPacker).RouteHttpRequest(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if action != "user.list" || render != tt.want {
+				t.Fatalf("action = %q, render = %q, want user.list and %q", action, render, tt.want)
+			}
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d", recorder.Code)
+			}
+		})
+	}
+}
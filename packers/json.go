@@ -3,10 +3,12 @@ package packers
 import (
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/leochen2038/play"
 	"github.com/leochen2038/play/codec/binders"
 	"github.com/leochen2038/play/codec/renders"
+	"github.com/tidwall/gjson"
 )
 
 const (
@@ -52,18 +54,30 @@ func (p *JsonPacker) Unpack(c *play.Conn) (*play.Request, error) {
 }
 
 func (p *JsonPacker) unpackHTTP(c *play.Conn, request *play.Request) (*play.Request, error) {
-	actionName, _ := p.httpPacker.ParseHttpPath(c.Http.Request.URL.Path)
-	request.ActionName = actionName
-	request.InputBinder = p.httpPacker.ParseHttpInput(c.Http.Request)
+	var err error
+	var params map[string]string
+	if request.ActionName, request.RenderName, params, err = p.httpPacker.RouteHttpRequest(c); err != nil {
+		return nil, err
+	}
+	if request.InputBinder, err = p.httpPacker.ParseHttpInputWithPolicy(c.Http.Request, p.httpPacker.BodyPolicy(c, request.ActionName)); err != nil {
+		if errors.Is(err, ErrRequestEntityTooLarge) {
+			c.Http.ResponseWriter.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else if errors.Is(err, ErrInvalidRequestBody) {
+			c.Http.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	request.InputBinder = binders.GetBinderOfPath(params, request.InputBinder)
 	return request, nil
 }
 
 func (p *JsonPacker) unpackWebSocket(c *play.Conn, request *play.Request) (*play.Request, error) {
-	actionName, _ := p.httpPacker.ParseHttpPath(c.Http.Request.URL.Path)
-	request.ActionName = actionName
+	request.ActionName, request.RenderName = p.httpPacker.ParseHttpPath(c.Http.Request.URL.Path)
 
 	if len(c.Websocket.Message) > 0 {
 		request.InputBinder = binders.GetBinderOfJson(c.Websocket.Message)
+		// 消息顶层的 requestId 用于关联响应, 响应中原样回传
+		request.RequestId = gjson.GetBytes(c.Websocket.Message, "requestId").String()
 	} else {
 		request.InputBinder = p.httpPacker.ParseHttpInput(c.Http.Request)
 	}
@@ -74,5 +88,39 @@ func (p *JsonPacker) Pack(c *play.Conn, res *play.Response) ([]byte, error) {
 	if res == nil {
 		return nil, ErrNilResponse
 	}
-	return renders.GetRenderOfJson().Render(res.Output.All())
+	if res.Body != nil && (c.Type == play.SERVER_TYPE_HTTP || c.Type == play.SERVER_TYPE_H2C || c.Type == play.SERVER_TYPE_HTTP3) {
+		return nil, serveBody(c, res)
+	}
+
+	// 未注册的 render 按json输出
+	var render = renders.Get(res.RenderName)
+	if render == nil {
+		render = renders.GetRenderOfJson()
+	}
+	var output = res.Output.All()
+	if res.RequestId != "" && c.Type == play.SERVER_TYPE_WS {
+		output = make(map[string]interface{}, len(res.Output.All())+1)
+		for k, v := range res.Output.All() {
+			output[k] = v
+		}
+		output["requestId"] = res.RequestId
+	}
+	data, err := render.Render(output)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSE 为流式输出, 由实例对整个事件流压缩
+	switch c.Type {
+	case play.SERVER_TYPE_HTTP, play.SERVER_TYPE_H2C, play.SERVER_TYPE_HTTP3:
+		c.Http.ResponseWriter.Header().Set("Content-Type", renders.ContentType(render.Name()))
+		if data, err = compressHttpBody(c, data); err != nil {
+			return nil, err
+		}
+		writeHttpResponseMeta(c, res)
+	case play.SERVER_TYPE_SSE:
+		writeHttpResponseMeta(c, res)
+		data = packServerEvent(res, data)
+	}
+	return data, nil
 }
@@ -0,0 +1,144 @@
+package packers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/codec/binders"
+	"github.com/leochen2038/play/codec/renders"
+	"github.com/tidwall/gjson"
+)
+
+// JSON-RPC 2.0 预定义的错误码
+const (
+	JsonRpcParseError     = -32700
+	JsonRpcInvalidRequest = -32600
+	JsonRpcMethodNotFound = -32601
+	JsonRpcInvalidParams  = -32602
+	JsonRpcInternalError  = -32603
+)
+
+// JsonRpcError JSON-RPC 错误对象
+type JsonRpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *JsonRpcError) Error() string {
+	return e.Message
+}
+
+type JsonRpcPacker struct{}
+
+// NewJsonRpcPacker 解析 Conn.JsonRpc.Message 中的单个请求对象, 批量请求由实例拆分后逐个调用;
+// 对象形式的 params 按名称绑定到 Input, 数组形式的 params 整体绑定到 Input 中 key 为 params 的字段
+func NewJsonRpcPacker() play.IPacker {
+	return &JsonRpcPacker{}
+}
+
+func (p *JsonRpcPacker) Unpack(c *play.Conn) (*play.Request, error) {
+	if c.Type != play.SERVER_TYPE_JSONRPC {
+		return nil, errors.New("jsonrpc packer not support " + strconv.Itoa(c.Type) + " type")
+	}
+
+	msg := gjson.ParseBytes(c.JsonRpc.Message)
+	c.JsonRpc.Id = nil
+	if id := msg.Get("id"); id.Exists() {
+		c.JsonRpc.Id = []byte(id.Raw)
+	}
+
+	method := msg.Get("method")
+	if !msg.IsObject() || msg.Get("jsonrpc").String() != "2.0" || method.Type != gjson.String || method.String() == "" || !validJsonRpcId(c.JsonRpc.Id) {
+		// 无法确定请求 id 时以 null 作为 id 返回错误
+		if !validJsonRpcId(c.JsonRpc.Id) || c.JsonRpc.Id == nil {
+			c.JsonRpc.Id = []byte("null")
+		}
+		return nil, &JsonRpcError{Code: JsonRpcInvalidRequest, Message: "Invalid Request"}
+	}
+
+	request := &play.Request{RenderName: "json", ActionName: method.String(), NonRespond: c.JsonRpc.Id == nil}
+	switch params := msg.Get("params"); {
+	case !params.Exists() || params.Type == gjson.Null:
+	case params.IsObject():
+		request.InputBinder = binders.GetBinderOfJson([]byte(params.Raw))
+	case params.IsArray():
+		// 按位置传参时整个数组绑定到 Input 中 key 为 params 的字段
+		request.InputBinder = binders.GetBinderOfJson([]byte(`{"params":` + params.Raw + `}`))
+	default:
+		return nil, &JsonRpcError{Code: JsonRpcInvalidParams, Message: "Invalid params: params must be an object or array"}
+	}
+	return request, nil
+}
+
+// Pack 通知不返回响应; res.Error 按 JsonRpcErrorOf 转换为错误对象
+func (p *JsonRpcPacker) Pack(c *play.Conn, res *play.Response) ([]byte, error) {
+	if res == nil {
+		return nil, ErrNilResponse
+	}
+	if c.JsonRpc.Id == nil {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return PackJsonRpcError(c.JsonRpc.Id, res.Error), nil
+	}
+
+	result, err := renders.GetRenderOfJson().Render(res.Output.All())
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(result)+len(c.JsonRpc.Id)+32)
+	data = append(data, `{"jsonrpc":"2.0","result":`...)
+	data = append(data, result...)
+	data = append(data, `,"id":`...)
+	data = append(data, c.JsonRpc.Id...)
+	return append(data, '}'), nil
+}
+
+// PackJsonRpcError 编码错误响应, id 为空时使用 null
+func PackJsonRpcError(id []byte, err error) []byte {
+	if len(id) == 0 {
+		id = []byte("null")
+	}
+	data, _ := json.Marshal(struct {
+		Jsonrpc string          `json:"jsonrpc"`
+		Error   *JsonRpcError   `json:"error"`
+		Id      json.RawMessage `json:"id"`
+	}{"2.0", JsonRpcErrorOf(err), id})
+	return data
+}
+
+// JsonRpcErrorOf 将错误转换为错误对象: play.Err 的错误码作为 code, Tip 作为 message;
+// 其余错误为 Internal error, 不向调用方暴露错误详情
+func JsonRpcErrorOf(err error) *JsonRpcError {
+	var rpcErr *JsonRpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	var e play.Err
+	if errors.As(err, &e) && (e.Code() != 0 || e.Tip() != "") {
+		rpcErr = &JsonRpcError{Code: e.Code(), Message: e.Tip()}
+		if rpcErr.Code == 0 {
+			rpcErr.Code = JsonRpcInternalError
+		}
+		if rpcErr.Message == "" {
+			rpcErr.Message = e.Error()
+		}
+		return rpcErr
+	}
+	return &JsonRpcError{Code: JsonRpcInternalError, Message: "Internal error"}
+}
+
+// validJsonRpcId id 只能是字符串、数字或 null
+func validJsonRpcId(id []byte) bool {
+	if id == nil {
+		return true
+	}
+	switch gjson.ParseBytes(id).Type {
+	case gjson.String, gjson.Number, gjson.Null:
+		return true
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package packers
 import (
 	"errors"
 	"io"
+	"strconv"
 
 	"github.com/leochen2038/play"
 	"github.com/leochen2038/play/codec/binders"
+	"github.com/leochen2038/play/codec/compressors"
 	"github.com/leochen2038/play/codec/protos/pproto"
 	"github.com/leochen2038/play/codec/renders"
 )
@@ -56,6 +58,8 @@ import (
 // 4  byte : rc错误码
 // 4  byte : body长度
 
+// protocol v5 在 v4 基础上增加 8 byte requestId 与 flags, 格式见 pproto 包
+
 type PlayPacker struct {
 }
 
@@ -77,6 +81,9 @@ func (p *PlayPacker) Unpack(c *play.Conn) (*play.Request, error) {
 			return nil, err
 		}
 		dataSize = _bytesToUint32(heaer[4:8])
+		if dataSize > pproto.MaxFrameSize {
+			return nil, pproto.ErrFrameTooLarge
+		}
 		buffer = make([]byte, dataSize+8)
 		copy(buffer, heaer)
 		if _, err = io.ReadFull(c.Quic.Stream, buffer[8:]); err != nil {
@@ -93,16 +100,27 @@ func (p *PlayPacker) Unpack(c *play.Conn) (*play.Request, error) {
 			c.Tcp.Surplus = buffer[dataSize:]
 		}
 
+		var requestId = protocol.Header.RequestId
+		// v5 的 requestId 为 0 表示不复用连接, 按顺序处理
+		if protocol.Version >= 5 && protocol.RequestId > 0 {
+			requestId = strconv.FormatUint(protocol.RequestId, 10)
+			if protocol.Flags&pproto.FlagCancel > 0 {
+				return &play.Request{Version: protocol.Version, RequestId: requestId, Cancel: true}, nil
+			}
+		}
 		return &play.Request{
-			Version:     protocol.Version,
-			ActionName:  protocol.Action,
-			TraceId:     protocol.Header.TraceId,
-			SpanId:      protocol.Header.SpanId,
-			CallerId:    protocol.Header.CallerId,
-			TagId:       protocol.Header.TagId,
-			NonRespond:  protocol.NonRespond,
-			Deadline:    protocol.Header.Deadline,
-			InputBinder: binders.GetBinderOfJson(protocol.Body),
+			Version:        protocol.Version,
+			ActionName:     protocol.Action,
+			TraceId:        protocol.Header.TraceId,
+			RequestId:      requestId,
+			Attachments:    protocol.Attachment,
+			SpanId:         protocol.Header.SpanId,
+			CallerId:       protocol.Header.CallerId,
+			TagId:          protocol.Header.TagId,
+			NonRespond:     protocol.NonRespond,
+			Deadline:       protocol.Header.Deadline,
+			InputBinder:    binders.GetBinderOfJson(protocol.Body),
+			AcceptEncoding: protocol.Header.AcceptEncoding,
 		}, nil
 	}
 	return nil, nil
@@ -137,6 +155,22 @@ func (p *PlayPacker) Pack(c *play.Conn, res *play.Response) (data []byte, err er
 	response := pproto.PlayProtocolResponse{Version: version, ResultCode: rc, Body: body}
 	response.Header.TraceId = res.TraceId
 
+	// v2/v3 协议没有 header, 不支持压缩和响应元数据
+	if version != 2 && version != 3 {
+		if c.Compress != nil {
+			if response.Body, response.Header.Encoding, err = compressors.NegotiateCompress(body, res.AcceptEncoding, c.Compress.MinSize, c.Compress.Encodings); err != nil {
+				return nil, err
+			}
+		}
+		response.Header.Status, response.Header.Meta = res.Status, responseMeta(res)
+		response.Attachment = res.Attachments
+		if version >= 5 {
+			response.RequestId, _ = strconv.ParseUint(res.RequestId, 10, 64)
+		} else {
+			response.Header.RequestId = res.RequestId
+		}
+	}
+
 	if buffer, err = pproto.MarshalProtocolResponse(response); err != nil {
 		return nil, err
 	}
@@ -144,6 +178,22 @@ func (p *PlayPacker) Pack(c *play.Conn, res *play.Response) (data []byte, err er
 	return buffer, nil
 }
 
+func responseMeta(res *play.Response) map[string][]string {
+	if len(res.Header) == 0 && len(res.Cookies) == 0 {
+		return nil
+	}
+	meta := make(map[string][]string, len(res.Header)+1)
+	for k, v := range res.Header {
+		meta[k] = v
+	}
+	for _, cookie := range res.Cookies {
+		if v := cookie.String(); v != "" {
+			meta["Set-Cookie"] = append(meta["Set-Cookie"], v)
+		}
+	}
+	return meta
+}
+
 func _bytesToUint32(data []byte) uint32 {
 	var ret uint32
 	var l = len(data)
@@ -0,0 +1,42 @@
+package packers
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/leochen2038/play"
+)
+
+var eventFieldReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// packServerEvent 按 text/event-stream 格式编码一个事件, data 的每一行输出为一个 data 字段
+func packServerEvent(res *play.Response, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 64)
+	if e := res.Event; e != nil {
+		if e.Id != "" {
+			buf.WriteString("id: " + eventFieldReplacer.Replace(e.Id) + "\n")
+		}
+		if e.Name != "" {
+			buf.WriteString("event: " + eventFieldReplacer.Replace(e.Name) + "\n")
+		}
+		if e.Retry > 0 {
+			buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+		}
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	for first := true; first || len(data) > 0; first = false {
+		line := data
+		if k := bytes.IndexByte(data, '\n'); k >= 0 {
+			line, data = data[:k], data[k+1:]
+		} else {
+			data = nil
+		}
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
@@ -0,0 +1,176 @@
+package play
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Route 路由规则, Pattern 形如 /users/{id}, 末尾的 {path...} 匹配剩余所有路径
+type Route struct {
+	Method   string
+	Pattern  string
+	Action   string
+	segments []string
+}
+
+type Router struct {
+	mu     sync.RWMutex
+	routes []*Route
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// ParseRoutes 解析action元数据中的路由定义, 多条规则以 ; 分隔, 如 "GET /users/{id}; DELETE /users/{id}"
+func ParseRoutes(meta string) (routes []Route, err error) {
+	for _, item := range strings.Split(meta, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		fields := strings.Fields(item)
+		switch len(fields) {
+		case 1:
+			routes = append(routes, Route{Pattern: fields[0]})
+		case 2:
+			routes = append(routes, Route{Method: strings.ToUpper(fields[0]), Pattern: fields[1]})
+		default:
+			return nil, errors.New("error route define:" + item)
+		}
+	}
+	return
+}
+
+// Add 添加路由, method 为空表示匹配所有方法
+func (r *Router) Add(method, pattern, action string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return errors.New("route pattern must begin with '/':" + pattern)
+	}
+	route := &Route{Method: strings.ToUpper(method), Pattern: pattern, Action: action, segments: splitPath(pattern)}
+	for i, seg := range route.segments {
+		if isParamSegment(seg) && strings.HasSuffix(seg, "...}") && i != len(route.segments)-1 {
+			return errors.New("wildcard segment must be the last one:" + pattern)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.routes {
+		if v.Method == route.Method && v.Pattern == route.Pattern {
+			return errors.New("route " + method + " " + pattern + " is already exists")
+		}
+	}
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+// Routes 返回按 pattern 排序的路由列表
+func (r *Router) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Route, 0, len(r.routes))
+	for _, v := range r.routes {
+		list = append(list, *v)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Pattern < list[j].Pattern
+	})
+	return list
+}
+
+// Match 匹配路由, 路径匹配但方法不符时 action 为空, allow 返回该路径允许的方法
+func (r *Router) Match(method, path string) (action string, params map[string]string, allow []string) {
+	var bestScore = -1
+	var segments = splitPath(path)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.routes {
+		score, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if !route.allowMethod(method) {
+			if route.Method != "" && !containsString(allow, route.Method) {
+				allow = append(allow, route.Method)
+			}
+			continue
+		}
+		if score > bestScore {
+			bestScore = score
+			action = route.Action
+			params = route.params(segments)
+		}
+	}
+	if action != "" {
+		allow = nil
+	}
+	return
+}
+
+func (route *Route) allowMethod(method string) bool {
+	return route.Method == "" || route.Method == method || (route.Method == http.MethodGet && method == http.MethodHead)
+}
+
+// match 静态片段越多得分越高
+func (route *Route) match(segments []string) (score int, ok bool) {
+	for i, seg := range route.segments {
+		if isParamSegment(seg) && strings.HasSuffix(seg, "...}") {
+			return score, len(segments) > i
+		}
+		if i >= len(segments) {
+			return 0, false
+		}
+		if isParamSegment(seg) {
+			continue
+		}
+		if seg != segments[i] {
+			return 0, false
+		}
+		score++
+	}
+	return score, len(segments) == len(route.segments)
+}
+
+func (route *Route) params(segments []string) map[string]string {
+	var params map[string]string
+	for i, seg := range route.segments {
+		if !isParamSegment(seg) {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string, 2)
+		}
+		if name := seg[1 : len(seg)-1]; strings.HasSuffix(name, "...") {
+			params[strings.TrimSuffix(name, "...")] = strings.Join(segments[i:], "/")
+			break
+		} else {
+			params[name] = segments[i]
+		}
+	}
+	return params
+}
+
+func isParamSegment(seg string) bool {
+	return len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}'
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
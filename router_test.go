@@ -0,0 +1,83 @@
+package play
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouterMatch(t *testing.T) {
+	r := NewRouter()
+	for _, v := range []struct{ method, pattern, action string }{
+		{"GET", "/users", "user.list"},
+		{"POST", "/users", "user.create"},
+		{"GET", "/users/{id}", "user.get"},
+		{"DELETE", "/users/{id}", "user.delete"},
+		{"GET", "/users/me", "user.me"},
+		{"", "/users/{id}/posts/{pid}", "post.get"},
+		{"GET", "/files/{path...}", "file.get"},
+		{"", "/", "index"},
+	} {
+		if err := r.Add(v.method, v.pattern, v.action); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		action string
+		params map[string]string
+		allow  []string
+	}{
+		{name: "static", method: "GET", path: "/users", action: "user.list"},
+		{name: "by method", method: "POST", path: "/users", action: "user.create"},
+		{name: "trailing slash", method: "GET", path: "/users/", action: "user.list"},
+		{name: "param", method: "GET", path: "/users/42", action: "user.get", params: map[string]string{"id": "42"}},
+		{name: "static before param", method: "GET", path: "/users/me", action: "user.me"},
+		{name: "param when static method differs", method: "DELETE", path: "/users/me", action: "user.delete", params: map[string]string{"id": "me"}},
+		{name: "any method", method: "PATCH", path: "/users/1/posts/2", action: "post.get", params: map[string]string{"id": "1", "pid": "2"}},
+		{name: "head as get", method: "HEAD", path: "/users/42", action: "user.get", params: map[string]string{"id": "42"}},
+		{name: "wildcard", method: "GET", path: "/files/a/b/c.txt", action: "file.get", params: map[string]string{"path": "a/b/c.txt"}},
+		{name: "wildcard requires segment", method: "GET", path: "/files", action: ""},
+		{name: "root", method: "GET", path: "/", action: "index"},
+		{name: "method not allowed", method: "PUT", path: "/users/42", allow: []string{"GET", "DELETE"}},
+		{name: "not found", method: "GET", path: "/orders/1"},
+		{name: "too long", method: "GET", path: "/users/1/posts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, params, allow := r.Match(tt.method, tt.path)
+			if action != tt.action {
+				t.Fatalf("action = %q, want %q", action, tt.action)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Fatalf("params = %v, want %v", params, tt.params)
+			}
+			if !reflect.DeepEqual(allow, tt.allow) {
+				t.Fatalf("allow = %v, want %v", allow, tt.allow)
+			}
+		})
+	}
+}
+
+func TestRouterAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		pattern string
+		wantErr bool
+	}{
+		{name: "ok", method: "get", pattern: "/a/{id}"},
+		{name: "duplicate", method: "GET", pattern: "/a/{id}", wantErr: true},
+		{name: "other method", method: "POST", pattern: "/a/{id}"},
+		{name: "relative", method: "GET", pattern: "a", wantErr: true},
+		{name: "wildcard not last", method: "GET", pattern: "/a/{p...}/b", wantErr: true},
+	}
+	r := NewRouter()
+	for _, tt := range tests {
+		if err := r.Add(tt.method, tt.pattern, "a"); (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -1,28 +1,36 @@
 package play
 
 import (
+	"io"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/quic-go/quic-go"
 	"github.com/leochen2038/play/codec/binders"
+	"github.com/quic-go/quic-go"
 )
 
 const (
-	SERVER_TYPE_HTTP  = 1
-	SERVER_TYPE_TCP   = 2
-	SERVER_TYPE_SSE   = 3
-	SERVER_TYPE_WS    = 4
-	SERVER_TYPE_H2C   = 5
-	SERVER_TYPE_QUIC  = 6
-	SERVER_TYPE_HTTP3 = 7
-	SERVER_TYPE_MCP   = 8
+	SERVER_TYPE_HTTP    = 1
+	SERVER_TYPE_TCP     = 2
+	SERVER_TYPE_SSE     = 3
+	SERVER_TYPE_WS      = 4
+	SERVER_TYPE_H2C     = 5
+	SERVER_TYPE_QUIC    = 6
+	SERVER_TYPE_HTTP3   = 7
+	SERVER_TYPE_MCP     = 8
+	SERVER_TYPE_GRPC    = 9
+	SERVER_TYPE_JSONRPC = 10
 
 	MCP_TRANSPORT_STDIO           = 1
 	MCP_TRANSPORT_STREAMABLE_HTTP = 2
+
+	JSONRPC_TRANSPORT_STDIO = 1
+	JSONRPC_TRANSPORT_HTTP  = 2 // HTTP POST 及同一地址上的 WebSocket
 )
 
 type IServerHook interface {
@@ -36,6 +44,12 @@ type IServerHook interface {
 	OnFinish(ctx *Context)
 }
 
+// IHeartbeatHook IServerHook 的可选扩展, 支持心跳的实例收到心跳响应时调用 OnHeartbeat, 因空闲断开连接前调用 OnIdle
+type IHeartbeatHook interface {
+	OnHeartbeat(sess *Session, rtt time.Duration)
+	OnIdle(sess *Session, idle time.Duration)
+}
+
 type IServer interface {
 	Info() IInstanceInfo
 	Ctrl() *InstanceCtrl
@@ -111,11 +125,15 @@ func (c *InstanceCtrl) WaitTask() {
 }
 
 type Conn struct {
-	Type    int
-	IsClose bool
-	Http    struct {
+	Type     int
+	IsClose  bool
+	Compress *CompressPolicy
+	Http     struct {
 		Request        *http.Request
 		ResponseWriter http.ResponseWriter
+		BodyPolicy     func(action string) BodyPolicy
+		Router         *Router
+		HeaderWritten  bool // 响应头已发送, 之后的 Response 元数据不再生效
 	}
 	Websocket struct {
 		Message       []byte
@@ -135,36 +153,173 @@ type Conn struct {
 	Mcp struct {
 		Data []byte
 	}
+	Grpc    interface{} // gRPC 调用的状态, 由 gRPC 实例设置为 *packers.GrpcConn, 核心包不依赖 gRPC
+	JsonRpc struct {
+		Message []byte // 当前处理的请求对象, 批量请求逐个处理
+		Id      []byte // 请求 id 的原始 JSON, 为空时是通知
+		Data    []byte // 已编码的响应对象
+	}
 }
 
 type Request struct {
-	Version     byte
-	RenderName  string
-	CallerId    int
-	TagId       int
-	TraceId     string
-	SpanId      []byte
-	NonRespond  bool
-	ActionName  string
-	Attach      []byte
-	Deadline    time.Time
-	InputBinder binders.Binder
+	Version        byte
+	RenderName     string
+	CallerId       int
+	TagId          int
+	TraceId        string
+	RequestId      string // 请求方生成的请求id, 同一连接并发处理时用于关联响应
+	SpanId         []byte
+	NonRespond     bool
+	Cancel         bool // 取消同一连接上 RequestId 相同的进行中请求, 不执行 action
+	ActionName     string
+	Attach         []byte
+	Attachments    map[string][]byte // pproto v4/v5 携带的附件
+	Deadline       time.Time
+	AcceptEncoding string
+	InputBinder    binders.Binder
+	Conn           *Conn // 解包所用的连接副本, 非空时响应经由该副本写出, 如 WebSocket 按请求消息的类型回复
 }
 
 type Response struct {
-	Version      byte
-	TraceId      string
-	TemplateRoot string
-	Template     string
-	RenderName   string
-	Error        error
-	Output       Output
-	ResponseSize int
+	Version        byte
+	TraceId        string
+	RequestId      string // 原样回传请求中的请求id
+	TemplateRoot   string
+	Template       string
+	RenderName     string
+	AcceptEncoding string
+	Error          error
+	Output         Output
+	ResponseSize   int
+	Status         int               // 响应状态码, 0:由传输层决定
+	Header         http.Header       // 自定义响应头
+	Cookies        []*http.Cookie    // 需要写入的 cookie
+	Body           *ResponseBody     // 非空时直接输出该内容, 忽略 Output
+	Attachments    map[string][]byte // 响应附件, 仅 pproto v4/v5 支持
+	Event          *ServerEvent      // SSE 事件的 id、事件名与重连间隔, 仅 SSE 传输使用
+	conn           *Conn
+}
+
+// ServerEvent SSE 事件字段, 为空的字段不输出
+type ServerEvent struct {
+	Id    string
+	Name  string
+	Retry time.Duration
+}
+
+// ResponseBody 以流的方式输出的响应体, 目前仅 HTTP 类传输支持
+// Reader 实现 io.ReadSeeker 时支持 Range 及条件请求, 实现 io.Closer 时输出后自动关闭
+type ResponseBody struct {
+	Reader      io.Reader
+	Name        string // 文件名, 用于推断 Content-Type 及下载时的文件名
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+	Attachment  bool // 以附件形式下载
+}
+
+// SendFile 输出文件内容
+func (r *Response) SendFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.Body = &ResponseBody{Reader: f, Name: filepath.Base(path), Size: info.Size(), ModTime: info.ModTime()}
+	return nil
+}
+
+// Download 以附件形式输出文件, filename 为空时使用文件名
+func (r *Response) Download(path string, filename string) error {
+	if err := r.SendFile(path); err != nil {
+		return err
+	}
+	if filename != "" {
+		r.Body.Name = filename
+	}
+	r.Body.Attachment = true
+	return nil
+}
+
+// SendReader 输出 reader 中的内容, name 用于推断 Content-Type
+func (r *Response) SendReader(reader io.Reader, name string) {
+	r.Body = &ResponseBody{Reader: reader, Name: name}
+}
+
+// SetAttachment 设置响应附件, 仅 pproto v4/v5 支持, 其它传输忽略
+func (r *Response) SetAttachment(key string, data []byte) {
+	if r.Attachments == nil {
+		r.Attachments = make(map[string][]byte, 2)
+	}
+	r.Attachments[key] = data
+}
+
+// SetEvent 设置 SSE 事件名与 id
+func (r *Response) SetEvent(name string, id string) {
+	if r.Event == nil {
+		r.Event = &ServerEvent{}
+	}
+	r.Event.Name, r.Event.Id = name, id
+}
+
+// SetStatus 设置响应状态码, HTTP 类传输写入状态行, pproto v4 写入响应头, 其它传输忽略
+func (r *Response) SetStatus(code int) {
+	r.Status = code
+}
+
+// SetHeader 设置响应头, 覆盖同名的已有值
+func (r *Response) SetHeader(key, value string) {
+	if r.Header == nil {
+		r.Header = make(http.Header, 2)
+	}
+	r.Header.Set(key, value)
+}
+
+// AddHeader 追加响应头
+func (r *Response) AddHeader(key, value string) {
+	if r.Header == nil {
+		r.Header = make(http.Header, 2)
+	}
+	r.Header.Add(key, value)
+}
+
+// SetCookie 写入cookie, 非HTTP传输以 Set-Cookie 头的形式携带
+func (r *Response) SetCookie(cookie *http.Cookie) {
+	r.Cookies = append(r.Cookies, cookie)
+}
+
+// Redirect 重定向到url, code 为 0 时使用 302
+func (r *Response) Redirect(url string, code int) {
+	if code == 0 {
+		code = http.StatusFound
+	}
+	r.SetHeader("Location", url)
+	r.Status = code
 }
 
 type ActionUnit struct {
-	Action      *Action
-	Space       string
-	Timeout     time.Duration
-	RequestName string
+	Action       *Action
+	Space        string
+	Timeout      time.Duration
+	RequestName  string
+	MaxBodySize  int64
+	StreamUpload bool
+	Routes       []Route // 由 @route 元数据声明的路由
+}
+
+// CompressPolicy 响应压缩策略
+type CompressPolicy struct {
+	MinSize   int      // 响应体达到该字节数才压缩
+	Encodings []string // 允许使用的压缩算法, 为空时允许所有已注册算法
+}
+
+// BodyPolicy 请求体读取策略
+type BodyPolicy struct {
+	MaxSize      int64 // 请求体最大字节数, 0:不限制
+	MaxMemory    int64 // multipart 解析时驻留内存的字节数, 超出部分写入临时文件
+	StreamUpload bool  // 上传文件不读入 File.Data, 通过 File.Open 按需读取
 }
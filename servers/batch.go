@@ -0,0 +1,282 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/codec/binders"
+	"github.com/leochen2038/play/codec/renders"
+	"github.com/tidwall/gjson"
+)
+
+// batchRefPattern 顺序执行时 input 中形如 "${id.path}" 的字符串替换为之前条目 Output 中的值, id 为条目的 id 或下标
+var batchRefPattern = regexp.MustCompile(`^\$\{([^.}]+)(?:\.([^}]*))?\}$`)
+
+// batchHandler 内置的批量调用入口, 一次 HTTP 请求调用多个 action
+type batchHandler struct {
+	path       string
+	maxEntries int
+}
+
+type batchRequest struct {
+	Sequential bool         `json:"sequential"`
+	Requests   []batchEntry `json:"requests"`
+}
+
+type batchEntry struct {
+	Id     string          `json:"id,omitempty"`
+	Action string          `json:"action"`
+	Input  json.RawMessage `json:"input,omitempty"`
+}
+
+type batchResult struct {
+	Id     string          `json:"id,omitempty"`
+	Action string          `json:"action"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  *batchError     `json:"error,omitempty"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newBatchHandler(path string, maxEntries int) *batchHandler {
+	if path == "" {
+		path = "/batch"
+	}
+	if maxEntries <= 0 {
+		maxEntries = 20
+	}
+	return &batchHandler{path: path, maxEntries: maxEntries}
+}
+
+// serve 每个条目在独立的会话上经 DoRequest 执行, 与普通请求一样经过 OnRequest 等钩子及 action 超时控制
+func (b *batchHandler) serve(sess *play.Session) error {
+	w, r := sess.Conn.Http.ResponseWriter, sess.Conn.Http.Request
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	limit := int64(4 << 20)
+	if sess.Conn.Http.BodyPolicy != nil {
+		if p := sess.Conn.Http.BodyPolicy(""); p.MaxSize > 0 {
+			limit = p.MaxSize
+		}
+	}
+	var batch batchRequest
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err == nil {
+		err = json.Unmarshal(data, &batch)
+	}
+	if err == nil && len(batch.Requests) > b.maxEntries {
+		err = errors.New("batch size exceeds " + strconv.Itoa(b.maxEntries))
+	}
+	if err != nil {
+		return writeBatchResponse(w, http.StatusBadRequest, map[string]*batchError{"error": {Code: http.StatusBadRequest, Message: err.Error()}})
+	}
+
+	traceId := play.NewTraceId()
+	results := make([]batchResult, len(batch.Requests))
+	if batch.Sequential {
+		for k, entry := range batch.Requests {
+			results[k] = b.call(sess, traceId, entry, results[:k], batch.Requests[:k])
+		}
+	} else {
+		var wg sync.WaitGroup
+		for k, entry := range batch.Requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[k] = b.call(sess, traceId, entry, nil, nil)
+			}()
+		}
+		wg.Wait()
+	}
+	return writeBatchResponse(w, http.StatusOK, map[string][]batchResult{"responses": results})
+}
+
+func (b *batchHandler) call(sess *play.Session, traceId string, entry batchEntry, prev []batchResult, prevEntries []batchEntry) (result batchResult) {
+	result.Id, result.Action = entry.Id, entry.Action
+	if sess.Server.LookupActionUnit(entry.Action) == nil {
+		result.Error = &batchError{Code: http.StatusNotFound, Message: "can not find action:" + entry.Action}
+		return
+	}
+
+	input := entry.Input
+	if prev != nil && len(input) > 0 {
+		var err error
+		if input, err = resolveBatchRefs(input, prev, prevEntries); err != nil {
+			result.Error = &batchError{Code: http.StatusFailedDependency, Message: err.Error()}
+			return
+		}
+	}
+
+	c := &batchCall{IServer: sess.Server}
+	sub := play.NewSession(sess.Context(), c)
+	sub.SessId, sub.User = sess.SessId, sess.User
+	sub.Conn.Http.Request, sub.Conn.Http.ResponseWriter = sess.Conn.Http.Request, &batchResponseWriter{header: make(http.Header)}
+
+	request := &play.Request{ActionName: entry.Action, TraceId: traceId, RenderName: "json"}
+	if len(input) > 0 {
+		request.InputBinder = binders.GetBinderOfJson(input)
+	}
+	if err := play.DoRequest(sub.Context(), sub, request); err != nil {
+		c.err = err
+	}
+	if string(c.output) != "null" {
+		result.Output = c.output
+	}
+	if c.err != nil {
+		result.Error = batchErrorOf(c.err)
+	}
+	return
+}
+
+// resolveBatchRefs 替换 input 中对之前条目 Output 的引用, 被引用的条目失败时返回错误
+func resolveBatchRefs(input json.RawMessage, prev []batchResult, prevEntries []batchEntry) (json.RawMessage, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var walk func(v interface{}) (interface{}, error)
+	walk = func(v interface{}) (interface{}, error) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k, item := range val {
+				var err error
+				if val[k], err = walk(item); err != nil {
+					return nil, err
+				}
+			}
+		case []interface{}:
+			for k, item := range val {
+				var err error
+				if val[k], err = walk(item); err != nil {
+					return nil, err
+				}
+			}
+		case string:
+			m := batchRefPattern.FindStringSubmatch(val)
+			if m == nil {
+				return val, nil
+			}
+			k := batchRefIndex(m[1], prevEntries)
+			if k < 0 || prev[k].Error != nil {
+				return nil, errors.New("reference " + val + " is not available")
+			}
+			if m[2] == "" {
+				return prev[k].Output, nil
+			}
+			if ref := gjson.GetBytes(prev[k].Output, m[2]); ref.Exists() {
+				return json.RawMessage(ref.Raw), nil
+			}
+			return nil, nil
+		}
+		return v, nil
+	}
+
+	value, err := walk(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// batchRefIndex 按 id 或下标查找之前的条目, 未找到时返回-1
+func batchRefIndex(ref string, prevEntries []batchEntry) int {
+	for k, entry := range prevEntries {
+		if entry.Id != "" && entry.Id == ref {
+			return k
+		}
+	}
+	if k, err := strconv.Atoi(ref); err == nil && k >= 0 && k < len(prevEntries) {
+		return k
+	}
+	return -1
+}
+
+// batchErrorOf play.Err 返回其错误码与 Tip, 其余错误不向调用方暴露详情
+func batchErrorOf(err error) *batchError {
+	var e play.Err
+	if errors.As(err, &e) && (e.Code() != 0 || e.Tip() != "") {
+		result := &batchError{Code: e.Code(), Message: e.Tip()}
+		if result.Code == 0 {
+			result.Code = http.StatusInternalServerError
+		}
+		if result.Message == "" {
+			result.Message = e.Error()
+		}
+		return result
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &batchError{Code: http.StatusGatewayTimeout, Message: "timeout"}
+	}
+	return &batchError{Code: http.StatusInternalServerError, Message: "internal error"}
+}
+
+func writeBatchResponse(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+// batchCall 条目的执行环境, 以 json 渲染 Output 并保存, 其余行为与所属实例一致
+type batchCall struct {
+	play.IServer
+	output []byte
+	err    error
+}
+
+func (c *batchCall) Packer() play.IPacker {
+	return c
+}
+
+func (c *batchCall) Unpack(conn *play.Conn) (*play.Request, error) {
+	return nil, errors.New("batch call not support unpack")
+}
+
+func (c *batchCall) Pack(conn *play.Conn, res *play.Response) ([]byte, error) {
+	if res.Error != nil {
+		c.err = res.Error
+	}
+	return renders.GetRenderOfJson().Render(res.Output.All())
+}
+
+func (c *batchCall) Transport(conn *play.Conn, data []byte) error {
+	c.output = data
+	return nil
+}
+
+// batchResponseWriter 条目中对响应头的设置不影响批量响应
+type batchResponseWriter struct {
+	header http.Header
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *batchResponseWriter) WriteHeader(statusCode int) {}
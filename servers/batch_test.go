@@ -0,0 +1,148 @@
+package servers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchRefIndex(t *testing.T) {
+	entries := []batchEntry{{Id: "user"}, {}, {Id: "2"}, {Id: "order"}}
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{ref: "user", want: 0},
+		{ref: "order", want: 3},
+		{ref: "1", want: 1},
+		{ref: "2", want: 2},
+		{ref: "0", want: 0},
+		{ref: "4", want: -1},
+		{ref: "-1", want: -1},
+		{ref: "missing", want: -1},
+	}
+	for _, tt := range tests {
+		if got := batchRefIndex(tt.ref, entries); got != tt.want {
+			t.Fatalf("batchRefIndex(%q) = %d, want %d", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolveBatchRefs(t *testing.T) {
+	prevEntries := []batchEntry{{Id: "user"}, {}, {Id: "fail"}}
+	prev := []batchResult{
+		{Output: json.RawMessage(`{"id":42,"name":"play","tags":["a","b"]}`)},
+		{Output: json.RawMessage(`{"total":3}`)},
+		{Error: &batchError{Code: 500}},
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "no refs", input: `{"a":1,"b":"x"}`, want: `{"a":1,"b":"x"}`},
+		{name: "by id", input: `{"uid":"${user.id}"}`, want: `{"uid":42}`},
+		{name: "by index", input: `{"n":"${1.total}"}`, want: `{"n":3}`},
+		{name: "whole output", input: `{"u":"${user}"}`, want: `{"u":{"id":42,"name":"play","tags":["a","b"]}}`},
+		{name: "nested path", input: `{"t":"${user.tags.1}"}`, want: `{"t":"b"}`},
+		{name: "in array", input: `{"ids":["${user.id}",7]}`, want: `{"ids":[42,7]}`},
+		{name: "missing path", input: `{"x":"${user.nope}"}`, want: `{"x":null}`},
+		{name: "not whole string", input: `{"x":"id ${user.id}"}`, want: `{"x":"id ${user.id}"}`},
+		{name: "large number kept", input: `{"x":12345678901234567890}`, want: `{"x":12345678901234567890}`},
+		{name: "failed entry", input: `{"x":"${fail.id}"}`, wantErr: true},
+		{name: "unknown entry", input: `{"x":"${order.id}"}`, wantErr: true},
+		{name: "invalid json", input: `{"x":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveBatchRefs(json.RawMessage(tt.input), prev, prevEntries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpInstanceBatch(t *testing.T) {
+	i := NewHttpInstance("http", "", nil, nil, 0).WithBatch("", 3)
+	if err := i.BindActionSpace("", "servertest"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(i)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		want   []string // 按顺序出现在响应中的片段
+	}{
+		{
+			name:   "parallel",
+			body:   `{"requests":[{"id":"a","action":"hello","input":{"name":"a"}},{"action":"hello"}]}`,
+			status: http.StatusOK,
+			want:   []string{`"id":"a"`, `"msg":"hello a"`, `"msg":"hello play"`},
+		},
+		{
+			name:   "sequential ref",
+			body:   `{"sequential":true,"requests":[{"id":"first","action":"hello","input":{"name":"x"}},{"action":"hello","input":{"name":"${first.msg}"}}]}`,
+			status: http.StatusOK,
+			want:   []string{`"msg":"hello x"`, `"msg":"hello hello x"`},
+		},
+		{
+			name:   "unknown action",
+			body:   `{"requests":[{"action":"nope"},{"action":"hello"}]}`,
+			status: http.StatusOK,
+			want:   []string{`"code":404`, `"msg":"hello play"`},
+		},
+		{
+			name:   "failed ref",
+			body:   `{"sequential":true,"requests":[{"id":"bad","action":"nope"},{"action":"hello","input":{"name":"${bad.msg}"}}]}`,
+			status: http.StatusOK,
+			want:   []string{`"code":404`, `"code":424`},
+		},
+		{
+			name:   "too many entries",
+			body:   `{"requests":[{"action":"hello"},{"action":"hello"},{"action":"hello"},{"action":"hello"}]}`,
+			status: http.StatusBadRequest,
+			want:   []string{"batch size exceeds 3"},
+		},
+		{name: "invalid body", body: `{"requests":`, status: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, _ := http.NewRequest(method, srv.URL+"/batch", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.status, body)
+			}
+			rest := string(body)
+			for _, want := range tt.want {
+				k := strings.Index(rest, want)
+				if k < 0 {
+					t.Fatalf("response %s missing %s", body, want)
+				}
+				rest = rest[k+len(want):]
+			}
+		})
+	}
+}
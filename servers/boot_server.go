@@ -69,31 +69,22 @@ func Boot(is ...play.IServer) error {
 	for _, i := range is {
 		if i != nil {
 			var i = i
-			var err error
-			var listener net.Listener
-			var udplistener net.PacketConn
-			var gracefulSocket = getGracefulSocket(i.Info().Name())
 			egr.Go(func() error {
+				var err error
+				var listener net.Listener
+				var udplistener net.PacketConn
 				switch i.Network() {
 				case "tcp":
-					if gracefulSocket > 0 {
-						if listener, err = net.FileListener(os.NewFile(gracefulSocket, "")); err != nil {
-							return err
-						}
-					} else {
-						if listener, err = net.Listen(i.Network(), i.Info().Address()); err != nil {
-							return err
-						}
+					var listeners []net.Listener
+					if listeners, err = listenStream(i.Info().Name(), i.Info().Address()); err != nil {
+						return err
+					}
+					if listener = listeners[0]; len(listeners) > 1 {
+						listener = newMultiListener(listeners)
 					}
 				case "udp":
-					if gracefulSocket > 0 {
-						if udplistener, err = net.FilePacketConn(os.NewFile(gracefulSocket, "")); err != nil {
-							return err
-						}
-					} else {
-						if udplistener, err = net.ListenPacket(i.Network(), i.Info().Address()); err != nil {
-							return err
-						}
+					if udplistener, err = listenPacket(i.Info().Name(), i.Info().Address()); err != nil {
+						return err
 					}
 				case "stdio":
 					// stdio 模式不需要 listener，直接运行
@@ -182,16 +173,25 @@ func reload() (int, error) {
 
 	var socketId = 0
 	instances.Range(func(key, value interface{}) bool {
-		var socket *os.File
+		var files []*os.File
 		run := value.(runningInstance)
 		if run.listener != nil {
-			socket, _ = run.listener.(filer).File()
+			files = listenerFiles(run.listener)
 		} else if run.udpListener != nil {
-			socket, _ = run.udpListener.(filer).File()
+			if socket, err := run.udpListener.(filer).File(); err == nil {
+				files = append(files, socket)
+			}
+		}
+		// 同一实例监听多个地址时以逗号分隔各 socket 的序号
+		var ids []string
+		for _, socket := range files {
+			sockes = append(sockes, socket)
+			ids = append(ids, strconv.Itoa(socketId))
+			socketId++
+		}
+		if len(ids) > 0 {
+			tags = append(tags, key.(string)+":"+strings.Join(ids, ","))
 		}
-		sockes = append(sockes, socket)
-		tags = append(tags, key.(string)+":"+strconv.Itoa(socketId))
-		socketId++
 		return true
 	})
 
@@ -253,13 +253,17 @@ func shouldKillParent() (err error) {
 	return
 }
 
-func getGracefulSocket(name string) (id uintptr) {
+// getGracefulSocket 返回平滑重启时从旧进程继承的 socket, 顺序与实例地址一致
+func getGracefulSocket(name string) (fds []uintptr) {
 	if os.Getenv(envGraceful) != "" {
 		for _, v := range strings.Split(os.Getenv(envGraceful), "|") {
 			if socket := strings.Split(v, ":"); len(socket) == 2 {
 				if socket[0] == name {
-					socketId, _ := strconv.Atoi(socket[1])
-					return uintptr(socketId) + 3
+					for _, id := range strings.Split(socket[1], ",") {
+						socketId, _ := strconv.Atoi(id)
+						fds = append(fds, uintptr(socketId)+3)
+					}
+					return
 				}
 			}
 		}
@@ -277,12 +281,29 @@ func bindActionSpace(server play.IServer, spaceName string, actionPackages []str
 			units := make([]*play.ActionUnit, 0, len(acts))
 			for _, act := range acts {
 				requestName := prefix + act.Name()
-				units = append(units, &play.ActionUnit{
+				unit := &play.ActionUnit{
 					Action:      act,
 					Space:       spaceName,
 					Timeout:     server.Info().DefaultActionTimeout(),
 					RequestName: requestName,
-				})
+				}
+				if size := act.MetaData()["maxBodySize"]; size != "" {
+					var err error
+					if unit.MaxBodySize, err = play.ParseByteSize(size); err != nil {
+						return errors.New("action " + requestName + " " + err.Error())
+					}
+				}
+				unit.StreamUpload = act.MetaData()["upload"] == "stream"
+				if route := act.MetaData()["route"]; route != "" {
+					var err error
+					if unit.Routes, err = play.ParseRoutes(route); err != nil {
+						return errors.New("action " + requestName + " " + err.Error())
+					}
+					for k := range unit.Routes {
+						unit.Routes[k].Action = requestName
+					}
+				}
+				units = append(units, unit)
 			}
 			if err := server.AddActionUnits(units...); err != nil {
 				return err
@@ -293,6 +314,34 @@ func bindActionSpace(server play.IServer, spaceName string, actionPackages []str
 	return nil
 }
 
+// actionBodyPolicy 以实例的读取策略为默认值, 由action的 @maxBodySize / @upload 元数据覆盖
+func actionBodyPolicy(server play.IServer, policy play.BodyPolicy) func(action string) play.BodyPolicy {
+	return func(action string) play.BodyPolicy {
+		var p = policy
+		if unit := server.LookupActionUnit(action); unit != nil {
+			if unit.MaxBodySize > 0 {
+				p.MaxSize = unit.MaxBodySize
+			}
+			if unit.StreamUpload {
+				p.StreamUpload = true
+			}
+		}
+		return p
+	}
+}
+
+// addActionRoutes 将action声明的路由注册到路由表
+func addActionRoutes(router *play.Router, units []*play.ActionUnit) error {
+	for _, unit := range units {
+		for _, route := range unit.Routes {
+			if err := router.Add(route.Method, route.Pattern, route.Action); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type defaultHook struct {
 }
 
@@ -0,0 +1,117 @@
+package servers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsPolicy 跨域策略, AllowOrigins 支持 "*" 及 "https://*.example.com" 形式的通配
+type CorsPolicy struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+var defaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+
+// AllowOrigin 判断 origin 是否在允许列表中
+func (p *CorsPolicy) AllowOrigin(origin string) bool {
+	for _, pattern := range p.AllowOrigins {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		if idx := strings.Index(pattern, "*"); idx >= 0 {
+			prefix, suffix := strings.ToLower(pattern[:idx]), strings.ToLower(pattern[idx+1:])
+			lower := strings.ToLower(origin)
+			if len(lower) > len(prefix)+len(suffix) && strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckOrigin 用于 websocket 升级时的 origin 校验, 非浏览器请求没有 Origin 头直接放行
+func (p *CorsPolicy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || p.AllowOrigin(origin)
+}
+
+// handle 写入跨域响应头, 预检请求在此处直接应答并返回true
+func (p *CorsPolicy) handle(w http.ResponseWriter, r *http.Request) (done bool) {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	if origin == "" {
+		return false
+	}
+	if !p.AllowOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		return preflight
+	}
+
+	if p.AllowCredentials || !p.allowAny() {
+		header.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		header.Set("Access-Control-Allow-Origin", "*")
+	}
+	if p.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(p.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+		}
+		return false
+	}
+
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	if !containsFold(methods, r.Header.Get("Access-Control-Request-Method")) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true
+	}
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(p.AllowHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(p.AllowHeaders, ", "))
+	} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if p.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (p *CorsPolicy) allowAny() bool {
+	for _, v := range p.AllowOrigins {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,373 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/packers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	v1reflectiongrpc "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	v1alphareflectiongrpc "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// grpcErrorCodeKey play.Err 的错误码通过 trailer 返回, gRPC 状态码无法表达业务错误码
+const grpcErrorCodeKey = "x-error-code"
+
+type grpcInstance struct {
+	info          play.IInstanceInfo
+	hook          play.IServerHook
+	ctrl          *play.InstanceCtrl
+	packer        play.IPacker
+	actions       map[string]*play.ActionUnit
+	sortedNames   []string
+	methods       map[string]*grpcMethod
+	services      map[string]protoreflect.ServiceDescriptor
+	files         *protoregistry.Files
+	errorCode     func(err error) codes.Code
+	reflection    bool
+	tlsConfig     *tls.Config
+	serverOptions []grpc.ServerOption
+	mu            sync.Mutex
+	server        *grpc.Server
+}
+
+type grpcMethod struct {
+	desc   protoreflect.MethodDescriptor
+	action string
+}
+
+// NewGrpcInstance gRPC 服务, 通过 WithService 注册的 proto 服务方法映射到 action, 支持一元及服务端流式方法
+func NewGrpcInstance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *grpcInstance {
+	if packer == nil {
+		packer = packers.NewGrpcPacker()
+	}
+	if hook == nil {
+		hook = defaultHook{}
+	}
+	if defaultActionTimeout == 0 {
+		defaultActionTimeout = defaultTimeout
+	}
+	return &grpcInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_GRPC, defaultActionTimeout), packer: packer,
+		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit), methods: make(map[string]*grpcMethod),
+		services: make(map[string]protoreflect.ServiceDescriptor), files: new(protoregistry.Files), errorCode: GrpcErrorCode}
+}
+
+func (i *grpcInstance) handleStream(srv interface{}, stream grpc.ServerStream) (err error) {
+	fullMethod, _ := grpc.MethodFromServerStream(stream)
+	m := i.methods[fullMethod]
+	if m == nil {
+		return status.Error(codes.Unimplemented, "unknown method "+fullMethod)
+	}
+	if m.desc.IsStreamingClient() {
+		return status.Error(codes.Unimplemented, "client streaming method "+fullMethod+" is not supported")
+	}
+	if i.LookupActionUnit(m.action) == nil {
+		return status.Error(codes.Unimplemented, "can not find action:"+m.action)
+	}
+
+	var request *play.Request
+	var sess = play.NewSession(stream.Context(), i)
+	var state = &packers.GrpcConn{Stream: stream, Method: m.desc, Action: m.action}
+	sess.Conn.Grpc = state
+
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			fmt.Printf("panic: %v\n%v", panicInfo, string(debug.Stack()))
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	defer func() {
+		i.hook.OnClose(sess, err)
+	}()
+	i.hook.OnConnect(sess, nil)
+	if request, err = i.packer.Unpack(sess.Conn); err != nil {
+		return i.status(stream, err)
+	}
+	if err = play.DoRequest(sess.Context(), sess, request); err != nil {
+		return i.status(stream, err)
+	}
+	if state.Error != nil {
+		return i.status(stream, state.Error)
+	}
+	if !state.Sent && !m.desc.IsStreamingServer() {
+		// 一元方法必须返回一条消息, Output 为空时发送空消息
+		return stream.SendMsg([]byte{})
+	}
+	return nil
+}
+
+// status 将错误转换为 gRPC 状态, play.Err 优先使用 Tip 作为状态消息
+func (i *grpcInstance) status(stream grpc.ServerStream, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	msg := err.Error()
+	var e play.Err
+	if errors.As(err, &e) {
+		if e.Tip() != "" {
+			msg = e.Tip()
+		}
+		if e.Code() != 0 {
+			stream.SetTrailer(metadata.Pairs(grpcErrorCodeKey, strconv.Itoa(e.Code())))
+		}
+	}
+	return status.Error(i.errorCode(err), msg)
+}
+
+// GrpcErrorCode 默认的错误码映射: play.Err 的错误码为 1~16 时直接作为 gRPC 状态码, 为 HTTP 状态码时按语义转换, 其余为 Unknown
+func GrpcErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	var e play.Err
+	if !errors.As(err, &e) {
+		return codes.Unknown
+	}
+	if e.Code() > 0 && e.Code() <= int(codes.Unauthenticated) {
+		return codes.Code(e.Code())
+	}
+	if code, ok := grpcHttpCodes[e.Code()]; ok {
+		return code
+	}
+	return codes.Unknown
+}
+
+var grpcHttpCodes = map[int]codes.Code{
+	400: codes.InvalidArgument,
+	401: codes.Unauthenticated,
+	403: codes.PermissionDenied,
+	404: codes.NotFound,
+	408: codes.DeadlineExceeded,
+	409: codes.AlreadyExists,
+	412: codes.FailedPrecondition,
+	429: codes.ResourceExhausted,
+	499: codes.Canceled,
+	500: codes.Internal,
+	501: codes.Unimplemented,
+	503: codes.Unavailable,
+	504: codes.DeadlineExceeded,
+}
+
+func (i *grpcInstance) Info() play.IInstanceInfo {
+	return i.info
+}
+
+func (i *grpcInstance) Ctrl() *play.InstanceCtrl {
+	return i.ctrl
+}
+
+func (i *grpcInstance) Hook() play.IServerHook {
+	return i.hook
+}
+
+func (i *grpcInstance) Packer() play.IPacker {
+	return i.packer
+}
+
+func (i *grpcInstance) Transport(conn *play.Conn, data []byte) error {
+	state, ok := conn.Grpc.(*packers.GrpcConn)
+	if !ok {
+		return errors.New("grpc instance transport not support " + strconv.Itoa(conn.Type) + " type")
+	}
+	err := state.Stream.SendMsg(data)
+	if err == nil {
+		state.Sent = true
+	}
+	return err
+}
+
+func (i *grpcInstance) Run(listener net.Listener, udplistener net.PacketConn) error {
+	opts := []grpc.ServerOption{grpc.UnknownServiceHandler(i.handleStream), grpc.ForceServerCodec(grpcCodec{})}
+	if i.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(i.tlsConfig)))
+	}
+	server := grpc.NewServer(append(opts, i.serverOptions...)...)
+	if i.reflection {
+		opts := reflection.ServerOptions{Services: i, DescriptorResolver: grpcResolver{i.files}}
+		v1reflectiongrpc.RegisterServerReflectionServer(server, reflection.NewServerV1(opts))
+		v1alphareflectiongrpc.RegisterServerReflectionServer(server, reflection.NewServer(opts))
+	}
+
+	i.mu.Lock()
+	i.server = server
+	i.mu.Unlock()
+	return server.Serve(listener)
+}
+
+// Close 停止接收新的调用并等待进行中的调用完成
+func (i *grpcInstance) Close() {
+	i.mu.Lock()
+	server := i.server
+	i.mu.Unlock()
+	if server != nil {
+		server.GracefulStop()
+	}
+	i.ctrl.WaitTask()
+}
+
+// GetServiceInfo 返回注册的 proto 服务及反射服务, 供服务反射列出服务
+func (i *grpcInstance) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := make(map[string]grpc.ServiceInfo, len(i.services)+2)
+	i.mu.Lock()
+	if i.server != nil {
+		for name, service := range i.server.GetServiceInfo() {
+			info[name] = service
+		}
+	}
+	i.mu.Unlock()
+	for name, service := range i.services {
+		var methods []grpc.MethodInfo
+		for j := 0; j < service.Methods().Len(); j++ {
+			m := service.Methods().Get(j)
+			methods = append(methods, grpc.MethodInfo{Name: string(m.Name()), IsClientStream: m.IsStreamingClient(), IsServerStream: m.IsStreamingServer()})
+		}
+		info[name] = grpc.ServiceInfo{Methods: methods, Metadata: service.ParentFile().Path()}
+	}
+	return info
+}
+
+// WithService 注册 proto 服务, actions 为方法名到 action 名的映射, 未映射的方法与 PbPacker 一致对应 "包名.服务名.方法名"
+func (i *grpcInstance) WithService(service protoreflect.ServiceDescriptor, actions map[string]string) *grpcInstance {
+	for j := 0; j < service.Methods().Len(); j++ {
+		m := service.Methods().Get(j)
+		fullMethod := "/" + string(service.FullName()) + "/" + string(m.Name())
+		action := actions[string(m.Name())]
+		if action == "" {
+			action = packers.ParseHttp2Path(fullMethod)
+		}
+		i.methods[fullMethod] = &grpcMethod{desc: m, action: action}
+	}
+	i.services[string(service.FullName())] = service
+	registerGrpcFile(i.files, service.ParentFile())
+	return i
+}
+
+// WithReflection 开启服务反射, 供 grpcurl 等工具查询服务及消息定义
+func (i *grpcInstance) WithReflection(enable bool) *grpcInstance {
+	i.reflection = enable
+	return i
+}
+
+// WithErrorCode 自定义错误到 gRPC 状态码的映射, 可在其中调用 GrpcErrorCode 处理其余错误
+func (i *grpcInstance) WithErrorCode(f func(err error) codes.Code) *grpcInstance {
+	i.errorCode = f
+	return i
+}
+
+func (i *grpcInstance) WithTlsConfig(config *tls.Config) *grpcInstance {
+	i.tlsConfig = config
+	return i
+}
+
+// WithServerOptions 追加 grpc.Server 的选项, 如 keepalive、消息大小限制及拦截器
+func (i *grpcInstance) WithServerOptions(opts ...grpc.ServerOption) *grpcInstance {
+	i.serverOptions = append(i.serverOptions, opts...)
+	return i
+}
+
+func (i *grpcInstance) Network() string {
+	return "tcp"
+}
+
+func (i *grpcInstance) LookupActionUnit(requestName string) *play.ActionUnit {
+	return i.actions[requestName]
+}
+
+func (i *grpcInstance) BindActionSpace(spaceName string, actionPackages ...string) error {
+	return bindActionSpace(i, spaceName, actionPackages)
+}
+
+func (i *grpcInstance) AddActionUnits(units ...*play.ActionUnit) error {
+	for _, u := range units {
+		if i.actions[u.RequestName] != nil {
+			return errors.New("action unit " + u.RequestName + " is already exists in " + i.info.Name())
+		}
+		i.actions[u.RequestName] = u
+		i.sortedNames = append(i.sortedNames, u.RequestName)
+	}
+	sort.Strings(i.sortedNames)
+	return nil
+}
+
+func (i *grpcInstance) ActionUnitNames() []string {
+	return append([]string(nil), i.sortedNames...)
+}
+
+func (i *grpcInstance) UpdateActionTimeout(spaceName string, actionName string, timeout time.Duration) {
+	if spaceName != "" {
+		spaceName = spaceName + "."
+	}
+	if act := i.actions[spaceName+actionName]; act != nil {
+		act.Timeout = timeout
+	}
+}
+
+// registerGrpcFile 将服务所在文件及其依赖加入反射使用的描述符集合
+func registerGrpcFile(files *protoregistry.Files, file protoreflect.FileDescriptor) {
+	if _, err := files.FindFileByPath(file.Path()); err == nil {
+		return
+	}
+	if err := files.RegisterFile(file); err != nil {
+		return
+	}
+	for j := 0; j < file.Imports().Len(); j++ {
+		registerGrpcFile(files, file.Imports().Get(j).FileDescriptor)
+	}
+}
+
+// grpcResolver 反射查询描述符时先查找注册的服务文件, 再查找全局注册的文件
+type grpcResolver struct {
+	files *protoregistry.Files
+}
+
+func (r grpcResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.files.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r grpcResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// grpcCodec 响应由 packer 编码为字节后原样发送, 其余消息使用 proto 编码
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	return encoding.GetCodec("proto").Marshal(v)
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	return encoding.GetCodec("proto").Unmarshal(data, v)
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
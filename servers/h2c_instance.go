@@ -24,6 +24,10 @@ type h2cInstance struct {
 	packer      play.IPacker
 	actions     map[string]*play.ActionUnit
 	sortedNames []string
+	bodyPolicy  play.BodyPolicy
+	router      *play.Router
+	compress    *play.CompressPolicy
+	batch       *batchHandler
 	tlsConfig   *tls.Config
 	httpServer  http.Server
 	http2server http2.Server
@@ -40,7 +44,7 @@ func NewH2cInstance(name string, addr string, hook play.IServerHook, packer play
 		defaultActionTimeout = defaultTimeout
 	}
 	return &h2cInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_H2C, defaultActionTimeout), packer: packer,
-		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit)}
+		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit), router: play.NewRouter()}
 }
 
 func (i *h2cInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -48,6 +52,9 @@ func (i *h2cInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var request *play.Request
 	var sess = play.NewSession(r.Context(), i)
 	sess.Conn.Http.Request, sess.Conn.Http.ResponseWriter = r, w
+	sess.Conn.Http.BodyPolicy = actionBodyPolicy(i, i.bodyPolicy)
+	sess.Conn.Http.Router = i.router
+	sess.Conn.Compress = i.compress
 
 	defer func() {
 		if panicInfo := recover(); panicInfo != nil {
@@ -61,10 +68,14 @@ func (i *h2cInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		i.hook.OnClose(sess, err)
 	}()
 	i.hook.OnConnect(sess, nil)
+	if i.batch != nil && r.URL.Path == i.batch.path {
+		err = i.batch.serve(sess)
+		return
+	}
 	if request, err = i.packer.Unpack(sess.Conn); err != nil {
 		return
 	}
-	err = play.DoRequest(r.Context(), sess, request)
+	err = play.DoRequest(sess.Context(), sess, request)
 }
 
 func (i *h2cInstance) update(r *http.Request) error {
@@ -113,6 +124,18 @@ func (i *h2cInstance) Close() {
 	i.ctrl.WaitTask()
 }
 
+// WithBatch 在 path 上开启批量调用入口, 默认 /batch; 单次最多 maxEntries 个条目, 默认20
+func (i *h2cInstance) WithBatch(path string, maxEntries int) *h2cInstance {
+	i.batch = newBatchHandler(path, maxEntries)
+	return i
+}
+
+// WithBodyPolicy 设置实例默认的请求体读取策略, action可通过 @maxBodySize 和 @upload: stream 覆盖
+func (i *h2cInstance) WithBodyPolicy(policy play.BodyPolicy) *h2cInstance {
+	i.bodyPolicy = policy
+	return i
+}
+
 func (i *h2cInstance) WithCertificate(cert tls.Certificate) *h2cInstance {
 	if i.tlsConfig == nil {
 		i.tlsConfig = &tls.Config{}
@@ -122,6 +145,12 @@ func (i *h2cInstance) WithCertificate(cert tls.Certificate) *h2cInstance {
 	return i
 }
 
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *h2cInstance) WithCompression(policy play.CompressPolicy) *h2cInstance {
+	i.compress = &policy
+	return i
+}
+
 func (i *h2cInstance) Network() string {
 	return "tcp"
 }
@@ -143,7 +172,17 @@ func (i *h2cInstance) AddActionUnits(units ...*play.ActionUnit) error {
 		i.sortedNames = append(i.sortedNames, u.RequestName)
 	}
 	sort.Strings(i.sortedNames)
-	return nil
+	return addActionRoutes(i.router, units)
+}
+
+// AddRoute 注册路由, method 为空时匹配所有方法, pattern 中 {name} 为路径参数, 末尾 {name...} 匹配剩余路径
+func (i *h2cInstance) AddRoute(method, pattern, action string) error {
+	return i.router.Add(method, pattern, action)
+}
+
+// Routes 返回实例的路由表
+func (i *h2cInstance) Routes() []play.Route {
+	return i.router.Routes()
 }
 
 // 返回actionNames的副本
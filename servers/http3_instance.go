@@ -0,0 +1,215 @@
+package servers
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/packers"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+type http3Instance struct {
+	info        play.IInstanceInfo
+	hook        play.IServerHook
+	ctrl        *play.InstanceCtrl
+	packer      play.IPacker
+	actions     map[string]*play.ActionUnit
+	sortedNames []string
+	bodyPolicy  play.BodyPolicy
+	router      *play.Router
+	compress    *play.CompressPolicy
+	cors        *CorsPolicy
+	tlsConfig   *tls.Config
+	quicConfig  *quic.Config
+	server      http3.Server
+}
+
+// NewHttp3Instance 基于 quic 的 HTTP/3 服务, 监听 udp 地址; 未设置证书时使用自签名证书
+func NewHttp3Instance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *http3Instance {
+	if packer == nil {
+		packer = packers.NewHttpPacker()
+	}
+	if hook == nil {
+		hook = defaultHook{}
+	}
+	if defaultActionTimeout == 0 {
+		defaultActionTimeout = defaultTimeout
+	}
+	return &http3Instance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_HTTP3, defaultActionTimeout), packer: packer,
+		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit), router: play.NewRouter()}
+}
+
+func (i *http3Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var request *play.Request
+	if i.cors != nil && i.cors.handle(w, r) {
+		return
+	}
+
+	var sess = play.NewSession(r.Context(), i)
+	sess.Conn.Http.Request, sess.Conn.Http.ResponseWriter = r, w
+	sess.Conn.Http.BodyPolicy = actionBodyPolicy(i, i.bodyPolicy)
+	sess.Conn.Http.Router = i.router
+	sess.Conn.Compress = i.compress
+
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			fmt.Printf("panic: %v\n%v", panicInfo, string(debug.Stack()))
+		}
+	}()
+	defer func() {
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+		i.hook.OnClose(sess, err)
+	}()
+	i.hook.OnConnect(sess, nil)
+	if request, err = i.packer.Unpack(sess.Conn); err != nil {
+		return
+	}
+	err = play.DoRequest(sess.Context(), sess, request)
+}
+
+// setAltSvc 写入 Alt-Svc 响应头, 告知 HTTP/1.1 与 HTTP/2 客户端可以改用 HTTP/3
+func (i *http3Instance) setAltSvc(header http.Header) {
+	_ = i.server.SetQUICHeaders(header)
+}
+
+func (i *http3Instance) Info() play.IInstanceInfo {
+	return i.info
+}
+
+func (i *http3Instance) Ctrl() *play.InstanceCtrl {
+	return i.ctrl
+}
+
+func (i *http3Instance) Hook() play.IServerHook {
+	return i.hook
+}
+
+func (i *http3Instance) Packer() play.IPacker {
+	return i.packer
+}
+
+func (i *http3Instance) Transport(conn *play.Conn, data []byte) error {
+	_, err := conn.Http.ResponseWriter.Write(data)
+	if f, ok := conn.Http.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	return err
+}
+
+// Run 在 Boot 创建或平滑重启时继承的 udp 连接上提供服务
+func (i *http3Instance) Run(listener net.Listener, udplistener net.PacketConn) error {
+	var tlsConfig = i.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = generateTLSConfig([]string{http3.NextProtoH3})
+	}
+	i.server.Handler = i
+	i.server.TLSConfig = http3.ConfigureTLSConfig(tlsConfig)
+	i.server.QUICConfig = i.quicConfig
+	if err := i.server.Serve(udplistener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close 等待进行中的请求完成后关闭 quic 监听, 已建立的连接收到 CONNECTION_CLOSE 后由客户端重连
+func (i *http3Instance) Close() {
+	i.ctrl.WaitTask()
+	_ = i.server.Close()
+}
+
+// WithBodyPolicy 设置实例默认的请求体读取策略, action可通过 @maxBodySize 和 @upload: stream 覆盖
+func (i *http3Instance) WithBodyPolicy(policy play.BodyPolicy) *http3Instance {
+	i.bodyPolicy = policy
+	return i
+}
+
+// WithCors 设置跨域策略, 预检请求由实例直接应答
+func (i *http3Instance) WithCors(policy *CorsPolicy) *http3Instance {
+	i.cors = policy
+	return i
+}
+
+func (i *http3Instance) WithCertificate(cert tls.Certificate) *http3Instance {
+	if i.tlsConfig == nil {
+		i.tlsConfig = &tls.Config{}
+	}
+	i.tlsConfig.Certificates = []tls.Certificate{cert}
+	i.tlsConfig.Rand = rand.Reader
+	return i
+}
+
+// WithTlsConfig 可与 quic 实例共用同一份证书配置, ALPN 由实例设置为 h3
+func (i *http3Instance) WithTlsConfig(config *tls.Config) *http3Instance {
+	i.tlsConfig = config
+	return i
+}
+
+func (i *http3Instance) WithQuicConfig(config *quic.Config) *http3Instance {
+	i.quicConfig = config
+	return i
+}
+
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *http3Instance) WithCompression(policy play.CompressPolicy) *http3Instance {
+	i.compress = &policy
+	return i
+}
+
+func (i *http3Instance) Network() string {
+	return "udp"
+}
+
+func (i *http3Instance) LookupActionUnit(requestName string) *play.ActionUnit {
+	return i.actions[requestName]
+}
+
+func (i *http3Instance) BindActionSpace(spaceName string, actionPackages ...string) error {
+	return bindActionSpace(i, spaceName, actionPackages)
+}
+
+func (i *http3Instance) AddActionUnits(units ...*play.ActionUnit) error {
+	for _, u := range units {
+		if i.actions[u.RequestName] != nil {
+			return errors.New("action unit " + u.RequestName + " is already exists in " + i.info.Name())
+		}
+		i.actions[u.RequestName] = u
+		i.sortedNames = append(i.sortedNames, u.RequestName)
+	}
+	sort.Strings(i.sortedNames)
+	return addActionRoutes(i.router, units)
+}
+
+// AddRoute 注册路由, method 为空时匹配所有方法, pattern 中 {name} 为路径参数, 末尾 {name...} 匹配剩余路径
+func (i *http3Instance) AddRoute(method, pattern, action string) error {
+	return i.router.Add(method, pattern, action)
+}
+
+// Routes 返回实例的路由表
+func (i *http3Instance) Routes() []play.Route {
+	return i.router.Routes()
+}
+
+func (i *http3Instance) ActionUnitNames() []string {
+	return append([]string(nil), i.sortedNames...)
+}
+
+func (i *http3Instance) UpdateActionTimeout(spaceName string, actionName string, timeout time.Duration) {
+	if spaceName != "" {
+		spaceName = spaceName + "."
+	}
+	if act := i.actions[spaceName+actionName]; act != nil {
+		act.Timeout = timeout
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	"runtime/debug"
@@ -23,11 +24,18 @@ type httpInstance struct {
 	packer      play.IPacker
 	actions     map[string]*play.ActionUnit
 	sortedNames []string
+	bodyPolicy  play.BodyPolicy
+	router      *play.Router
+	compress    *play.CompressPolicy
+	batch       *batchHandler
+	cors        *CorsPolicy
+	statics     []*staticHandler
 	tlsConfig   *tls.Config
 	httpServer  http.Server
 	ws          *wsInstance
 	sse         *sseInstance
 	h2c         *h2cInstance
+	http3       *http3Instance
 	mcp         *mcpInstance
 }
 
@@ -41,7 +49,7 @@ func NewHttpInstance(name string, addr string, hook play.IServerHook, packer pla
 	if defaultActionTimeout == 0 {
 		defaultActionTimeout = defaultTimeout
 	}
-	return &httpInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_HTTP, defaultActionTimeout), packer: packer, hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit)}
+	return &httpInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_HTTP, defaultActionTimeout), packer: packer, hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit), router: play.NewRouter()}
 }
 
 func (i *httpInstance) Run(listener net.Listener, udplistener net.PacketConn) error {
@@ -81,21 +89,48 @@ func (i *httpInstance) Ctrl() *play.InstanceCtrl {
 func (i *httpInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var request *play.Request
+	if i.http3 != nil {
+		i.http3.setAltSvc(w.Header())
+	}
+	if i.cors != nil && i.cors.handle(w, r) {
+		return
+	}
+	for _, static := range i.statics {
+		if static.serve(w, r) {
+			return
+		}
+	}
+
 	var sess = play.NewSession(r.Context(), i)
 	sess.Conn.Http.Request, sess.Conn.Http.ResponseWriter = r, w
+	sess.Conn.Http.BodyPolicy = actionBodyPolicy(i, i.bodyPolicy)
+	sess.Conn.Http.Router = i.router
+	sess.Conn.Compress = i.compress
 	if i.ws != nil {
-		if conn, _ := i.ws.update(w, r); conn != nil {
+		if conn, err := i.ws.update(w, r); conn != nil {
 			sess.Server = i.ws
 			sess.Conn.Type = play.SERVER_TYPE_WS
 			sess.Conn.Websocket.WebsocketConn = conn
 			i.ws.accept(sess)
 			return
+		} else if err != errNotWebsocket {
+			// 升级失败时 upgrader 已写入错误响应
+			return
 		}
 	}
 
 	if i.sse != nil {
 		if err = i.sse.update(r); err == nil {
+			// http 实例设置了跨域策略时响应头已写入, 否则由 SSE 实例的策略写入
+			if err = i.sse.checkOrigin(w, r); err != nil {
+				i.hook.OnConnect(sess, err)
+				return
+			}
+			if i.cors == nil && i.sse.cors != nil {
+				i.sse.cors.handle(w, r)
+			}
 			sess.Server = i.sse
+			sess.Conn.Type = play.SERVER_TYPE_SSE
 			i.sse.accept(sess)
 			return
 		}
@@ -126,10 +161,14 @@ func (i *httpInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		i.hook.OnClose(sess, err)
 	}()
 	i.hook.OnConnect(sess, nil)
+	if i.batch != nil && r.URL.Path == i.batch.path {
+		err = i.batch.serve(sess)
+		return
+	}
 	if request, err = i.packer.Unpack(sess.Conn); err != nil {
 		return
 	}
-	err = play.DoRequest(r.Context(), sess, request)
+	err = play.DoRequest(sess.Context(), sess, request)
 }
 
 func (i *httpInstance) SetWSInstance(ws *wsInstance) {
@@ -144,10 +183,40 @@ func (i *httpInstance) SetH2cInstance(h2c *h2cInstance) {
 	i.h2c = h2c
 }
 
+// SetHttp3Instance 在响应中输出 Alt-Svc, 告知客户端可以改用 HTTP/3 访问
+func (i *httpInstance) SetHttp3Instance(h3 *http3Instance) {
+	i.http3 = h3
+}
+
 func (i *httpInstance) SetMCPInstance(m *mcpInstance) {
 	i.mcp = m
 }
 
+// WithBatch 在 path 上开启批量调用入口, 默认 /batch; 单次最多 maxEntries 个条目, 默认20
+func (i *httpInstance) WithBatch(path string, maxEntries int) *httpInstance {
+	i.batch = newBatchHandler(path, maxEntries)
+	return i
+}
+
+// WithBodyPolicy 设置实例默认的请求体读取策略, action可通过 @maxBodySize 和 @upload: stream 覆盖
+func (i *httpInstance) WithBodyPolicy(policy play.BodyPolicy) *httpInstance {
+	i.bodyPolicy = policy
+	return i
+}
+
+// WithCors 设置跨域策略, 预检请求由实例直接应答
+func (i *httpInstance) WithCors(policy *CorsPolicy) *httpInstance {
+	i.cors = policy
+	return i
+}
+
+// WithStatic 将 prefix 下的 GET/HEAD 请求映射到 fsys 中的文件, 文件不存在时交由 action 处理
+// fsys 可以是 os.DirFS、embed.FS 或内存中的 fstest.MapFS
+func (i *httpInstance) WithStatic(prefix string, fsys fs.FS) *httpInstance {
+	i.statics = append(i.statics, newStaticHandler(prefix, fsys))
+	return i
+}
+
 func (i *httpInstance) WithCertificate(cert tls.Certificate) *httpInstance {
 	if i.tlsConfig == nil {
 		i.tlsConfig = &tls.Config{}
@@ -158,6 +227,12 @@ func (i *httpInstance) WithCertificate(cert tls.Certificate) *httpInstance {
 	return i
 }
 
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *httpInstance) WithCompression(policy play.CompressPolicy) *httpInstance {
+	i.compress = &policy
+	return i
+}
+
 func (i *httpInstance) Network() string {
 	return "tcp"
 }
@@ -196,5 +271,15 @@ func (i *httpInstance) AddActionUnits(units ...*play.ActionUnit) error {
 		i.sortedNames = append(i.sortedNames, u.RequestName)
 	}
 	sort.Strings(i.sortedNames)
-	return nil
+	return addActionRoutes(i.router, units)
+}
+
+// AddRoute 注册路由, method 为空时匹配所有方法, pattern 中 {name} 为路径参数, 末尾 {name...} 匹配剩余路径
+func (i *httpInstance) AddRoute(method, pattern, action string) error {
+	return i.router.Add(method, pattern, action)
+}
+
+// Routes 返回实例的路由表
+func (i *httpInstance) Routes() []play.Route {
+	return i.router.Routes()
 }
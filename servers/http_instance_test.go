@@ -0,0 +1,82 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leochen2038/play"
+)
+
+type testHello struct {
+	Input struct {
+		Name string `key:"name" default:"play"`
+	}
+	Output struct {
+		Msg string `key:"msg"`
+	}
+}
+
+func (p *testHello) Run(ctx *play.Context) (string, error) {
+	p.Output.Msg = "hello " + p.Input.Name
+	return "", nil
+}
+
+func init() {
+	play.RegisterAction("servertest", "hello", nil, func() interface{} {
+		return play.NewProcessorWrap(new(testHello), func(p play.Processor, ctx *play.Context) (string, error) {
+			return play.RunProcessor(nil, 0, p, ctx)
+		}, nil)
+	})
+}
+
+func TestHttpInstanceMountedSSE(t *testing.T) {
+	sse := NewSSEInstance("sse", "", nil, nil, 0).WithKeepalive(0)
+	i := NewHttpInstance("http", "", nil, nil, 0)
+	i.SetSSEInstance(sse)
+	if err := i.BindActionSpace("", "servertest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sse.BindActionSpace("", "servertest"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(i)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/hello?name=sse", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	var event []string
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimRight(line, "\n"); line == "" {
+			break
+		}
+		event = append(event, line)
+	}
+	if len(event) != 1 || !strings.HasPrefix(event[0], "data: ") || !strings.Contains(event[0], `"msg":"hello sse"`) {
+		t.Fatalf("event = %q, want one data line with the action output", event)
+	}
+}
@@ -0,0 +1,292 @@
+package servers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/packers"
+	"github.com/tidwall/gjson"
+)
+
+type jsonRpcInstance struct {
+	info        play.IInstanceInfo
+	hook        play.IServerHook
+	ctrl        *play.InstanceCtrl
+	packer      play.IPacker
+	actions     map[string]*play.ActionUnit
+	sortedNames []string
+	methods     map[string]string
+	transport   int
+	readLimit   int64
+	upgrader    websocket.Upgrader
+	httpServer  http.Server
+}
+
+// NewJsonRpcInstance JSON-RPC 2.0 服务, transport 为 play.JSONRPC_TRANSPORT_HTTP 时同一地址同时接受 HTTP POST 与 WebSocket,
+// 为 play.JSONRPC_TRANSPORT_STDIO 时从标准输入按行读取请求, 响应按行写到标准输出
+func NewJsonRpcInstance(name string, addr string, hook play.IServerHook, transport int, defaultActionTimeout time.Duration) *jsonRpcInstance {
+	if hook == nil {
+		hook = defaultHook{}
+	}
+	if defaultActionTimeout == 0 {
+		defaultActionTimeout = defaultTimeout
+	}
+	return &jsonRpcInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_JSONRPC, defaultActionTimeout), packer: packers.NewJsonRpcPacker(),
+		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit), methods: make(map[string]string),
+		transport: transport, readLimit: 4 << 20}
+}
+
+func (i *jsonRpcInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		i.serveWebsocket(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	var sess = play.NewSession(r.Context(), i)
+	sess.Conn.Http.Request, sess.Conn.Http.ResponseWriter = r, w
+
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			fmt.Fprintf(os.Stderr, "panic: %v\n%v", panicInfo, string(debug.Stack()))
+		}
+	}()
+	defer func() {
+		i.hook.OnClose(sess, err)
+	}()
+	i.hook.OnConnect(sess, nil)
+
+	var payload []byte
+	if payload, err = io.ReadAll(http.MaxBytesReader(w, r.Body, i.readLimit)); err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	data := i.handle(sess, payload)
+	if data == nil {
+		// 全部为通知时没有响应内容
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+}
+
+func (i *jsonRpcInstance) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := i.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(i.readLimit)
+
+	var sess = play.NewSession(r.Context(), i)
+	sess.Conn.Http.Request = r
+	sess.Conn.Websocket.WebsocketConn = conn
+
+	defer func() {
+		if panicInfo := recover(); panicInfo != nil {
+			fmt.Fprintf(os.Stderr, "panic: %v\n%v", panicInfo, string(debug.Stack()))
+		}
+	}()
+	defer func() {
+		i.hook.OnClose(sess, err)
+	}()
+	i.hook.OnConnect(sess, nil)
+
+	var message []byte
+	for {
+		if _, message, err = conn.ReadMessage(); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				err = nil
+			}
+			return
+		}
+		if data := i.handle(sess, message); data != nil {
+			if err = conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveStdio 每行一个请求或批量请求, 空行忽略
+func (i *jsonRpcInstance) serveStdio(r io.Reader, w io.Writer) (err error) {
+	var sess = play.NewSession(context.Background(), i)
+	defer func() {
+		i.hook.OnClose(sess, err)
+	}()
+	i.hook.OnConnect(sess, nil)
+
+	reader := bufio.NewReader(r)
+	var line []byte
+	for {
+		if line, err = reader.ReadBytes('\n'); len(bytes.TrimSpace(line)) > 0 {
+			if data := i.handle(sess, line); data != nil {
+				if _, werr := w.Write(append(data, '\n')); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return err
+		}
+	}
+}
+
+// handle 处理单个请求或批量请求, 无需响应时返回 nil
+func (i *jsonRpcInstance) handle(sess *play.Session, payload []byte) []byte {
+	payload = bytes.TrimSpace(payload)
+	if !gjson.ValidBytes(payload) {
+		return packers.PackJsonRpcError(nil, &packers.JsonRpcError{Code: packers.JsonRpcParseError, Message: "Parse error"})
+	}
+	if payload[0] != '[' {
+		return i.call(sess, payload)
+	}
+
+	messages := gjson.ParseBytes(payload).Array()
+	if len(messages) == 0 {
+		return packers.PackJsonRpcError(nil, &packers.JsonRpcError{Code: packers.JsonRpcInvalidRequest, Message: "Invalid Request"})
+	}
+	batch := []byte{'['}
+	for _, message := range messages {
+		if data := i.call(sess, []byte(message.Raw)); data != nil {
+			if len(batch) > 1 {
+				batch = append(batch, ',')
+			}
+			batch = append(batch, data...)
+		}
+	}
+	if len(batch) == 1 {
+		return nil
+	}
+	return append(batch, ']')
+}
+
+// call 在会话上按顺序处理一个请求对象, 返回编码后的响应
+func (i *jsonRpcInstance) call(sess *play.Session, message []byte) []byte {
+	c := sess.Conn
+	c.JsonRpc.Message, c.JsonRpc.Data = message, nil
+	request, err := i.packer.Unpack(c)
+	if err != nil {
+		if c.JsonRpc.Id == nil {
+			return nil
+		}
+		return packers.PackJsonRpcError(c.JsonRpc.Id, err)
+	}
+	if action, ok := i.methods[request.ActionName]; ok {
+		request.ActionName = action
+	}
+	if i.LookupActionUnit(request.ActionName) == nil {
+		if request.NonRespond {
+			return nil
+		}
+		return packers.PackJsonRpcError(c.JsonRpc.Id, &packers.JsonRpcError{Code: packers.JsonRpcMethodNotFound, Message: "Method not found"})
+	}
+	_ = play.DoRequest(sess.Context(), sess, request)
+	return c.JsonRpc.Data
+}
+
+// WithMethod 将 JSON-RPC 方法名映射到 action, 未映射的方法名直接作为 action 名
+func (i *jsonRpcInstance) WithMethod(method string, action string) *jsonRpcInstance {
+	i.methods[method] = action
+	return i
+}
+
+// WithReadLimit 单个 HTTP 请求体、WebSocket 消息的最大字节数, 默认4MB
+func (i *jsonRpcInstance) WithReadLimit(limit int64) *jsonRpcInstance {
+	i.readLimit = limit
+	return i
+}
+
+func (i *jsonRpcInstance) Info() play.IInstanceInfo {
+	return i.info
+}
+
+func (i *jsonRpcInstance) Ctrl() *play.InstanceCtrl {
+	return i.ctrl
+}
+
+func (i *jsonRpcInstance) Hook() play.IServerHook {
+	return i.hook
+}
+
+func (i *jsonRpcInstance) Packer() play.IPacker {
+	return i.packer
+}
+
+func (i *jsonRpcInstance) Transport(conn *play.Conn, data []byte) error {
+	conn.JsonRpc.Data = data
+	return nil
+}
+
+func (i *jsonRpcInstance) Run(listener net.Listener, udplistener net.PacketConn) error {
+	if i.transport == play.JSONRPC_TRANSPORT_STDIO {
+		return i.serveStdio(os.Stdin, os.Stdout)
+	}
+	i.httpServer.Handler = i
+	return i.httpServer.Serve(listener)
+}
+
+func (i *jsonRpcInstance) Close() {
+	i.ctrl.WaitTask()
+}
+
+func (i *jsonRpcInstance) Network() string {
+	if i.transport == play.JSONRPC_TRANSPORT_STDIO {
+		return "stdio"
+	}
+	return "tcp"
+}
+
+func (i *jsonRpcInstance) LookupActionUnit(requestName string) *play.ActionUnit {
+	return i.actions[requestName]
+}
+
+func (i *jsonRpcInstance) BindActionSpace(spaceName string, actionPackages ...string) error {
+	return bindActionSpace(i, spaceName, actionPackages)
+}
+
+func (i *jsonRpcInstance) AddActionUnits(units ...*play.ActionUnit) error {
+	for _, u := range units {
+		if i.actions[u.RequestName] != nil {
+			return errors.New("action unit " + u.RequestName + " is already exists in " + i.info.Name())
+		}
+		i.actions[u.RequestName] = u
+		i.sortedNames = append(i.sortedNames, u.RequestName)
+	}
+	sort.Strings(i.sortedNames)
+	return nil
+}
+
+func (i *jsonRpcInstance) ActionUnitNames() []string {
+	return append([]string(nil), i.sortedNames...)
+}
+
+func (i *jsonRpcInstance) UpdateActionTimeout(spaceName string, actionName string, timeout time.Duration) {
+	if spaceName != "" {
+		spaceName = spaceName + "."
+	}
+	if act := i.actions[spaceName+actionName]; act != nil {
+		act.Timeout = timeout
+	}
+}
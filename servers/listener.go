@@ -0,0 +1,296 @@
+package servers
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 实例地址可以是以逗号分隔的多个地址, 每个地址为以下形式之一:
+//   - host:port                 按 IServer.Network() 监听 tcp 或 udp
+//   - unix:/run/app.sock?mode=0660  unix socket, mode 为 socket 文件权限, 仅用于 tcp 类实例
+//   - systemd 或 systemd:name   使用 systemd socket activation 传入的 socket, name 对应 FileDescriptorName
+// 平滑重启时新进程按地址顺序继承旧进程的全部 socket, 不再重新监听
+
+// listenStream 创建实例的全部流式监听, 平滑重启时继承旧进程的 socket
+func listenStream(name string, address string) (listeners []net.Listener, err error) {
+	defer func() {
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			listeners = nil
+		}
+	}()
+
+	if fds := getGracefulSocket(name); len(fds) > 0 {
+		for _, fd := range fds {
+			var l net.Listener
+			if l, err = net.FileListener(os.NewFile(fd, "")); err != nil {
+				return
+			}
+			listeners = append(listeners, l)
+		}
+		return
+	}
+
+	for _, addr := range splitAddress(address) {
+		switch {
+		case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+			var files []*os.File
+			if files, err = systemdFiles(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":")); err != nil {
+				return
+			}
+			for _, f := range files {
+				var l net.Listener
+				if l, err = net.FileListener(f); err != nil {
+					return
+				}
+				listeners = append(listeners, l)
+			}
+		case strings.HasPrefix(addr, "unix:"):
+			var l net.Listener
+			if l, err = listenUnix(addr); err != nil {
+				return
+			}
+			listeners = append(listeners, l)
+		default:
+			var l net.Listener
+			if l, err = net.Listen("tcp", addr); err != nil {
+				return
+			}
+			listeners = append(listeners, l)
+		}
+	}
+	return
+}
+
+// listenPacket 创建实例的 udp 监听, quic 等基于 udp 的实例只支持一个地址
+func listenPacket(name string, address string) (net.PacketConn, error) {
+	if fds := getGracefulSocket(name); len(fds) > 0 {
+		return net.FilePacketConn(os.NewFile(fds[0], ""))
+	}
+
+	addrs := splitAddress(address)
+	if len(addrs) != 1 {
+		return nil, errors.New("udp server " + name + " supports only one address")
+	}
+	switch addr := addrs[0]; {
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		files, err := systemdFiles(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+		if err != nil {
+			return nil, err
+		}
+		return net.FilePacketConn(files[0])
+	case strings.HasPrefix(addr, "unix:"):
+		return nil, errors.New("udp server " + name + " can not listen on " + addr)
+	default:
+		return net.ListenPacket("udp", addr)
+	}
+}
+
+func splitAddress(address string) (addrs []string) {
+	for _, addr := range strings.Split(address, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		// 与 net.Listen 一致, 空地址监听随机端口
+		addrs = []string{""}
+	}
+	return
+}
+
+// listenUnix 监听 unix socket, 残留的 socket 文件在无进程监听时删除
+// socket 文件在关闭时不删除, 以便平滑重启时新进程继续使用
+func listenUnix(addr string) (net.Listener, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Path
+	}
+
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, errors.New("unix socket " + path + " is in use")
+		}
+		_ = os.Remove(path)
+	}
+
+	var perm uint64
+	if mode := u.Query().Get("mode"); mode != "" {
+		if perm, err = strconv.ParseUint(mode, 8, 32); err != nil {
+			return nil, errors.New("unix socket " + path + " mode error:" + err.Error())
+		}
+	}
+
+	// socket 在 listen 后即可被连接, 先以仅属主可访问的权限创建, 再改为指定权限
+	umaskMu.Lock()
+	umask := syscall.Umask(0o077)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	syscall.Umask(umask)
+	umaskMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	if perm == 0 {
+		perm = uint64(0o777 &^ umask)
+	}
+	if err = os.Chmod(path, os.FileMode(perm)); err != nil {
+		_ = l.Close()
+		return nil, errors.New("unix socket " + path + " mode error:" + err.Error())
+	}
+	return l, nil
+}
+
+var umaskMu sync.Mutex
+
+// systemdSocket systemd 传入的 socket, 每个只交给一个监听使用
+type systemdSocket struct {
+	file *os.File
+	name string
+	used bool
+}
+
+var (
+	systemdOnce    sync.Once
+	systemdMu      sync.Mutex
+	systemdSockets []*systemdSocket
+)
+
+// parseSystemdSockets 与 sd_listen_fds 一致, 读取后清除环境变量, 避免子进程误用
+func parseSystemdSockets() {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for k := 0; k < n; k++ {
+		var fdName string
+		if k < len(names) {
+			fdName = names[k]
+		}
+		syscall.CloseOnExec(3 + k)
+		systemdSockets = append(systemdSockets, &systemdSocket{file: os.NewFile(uintptr(3+k), fdName), name: fdName})
+	}
+}
+
+// systemdFiles 返回 systemd socket activation 传入且尚未被使用的 socket, name 为空时返回全部
+func systemdFiles(name string) ([]*os.File, error) {
+	systemdOnce.Do(parseSystemdSockets)
+	if len(systemdSockets) == 0 {
+		return nil, errors.New("no socket passed by systemd")
+	}
+
+	systemdMu.Lock()
+	defer systemdMu.Unlock()
+	var files []*os.File
+	for _, socket := range systemdSockets {
+		if !socket.used && (name == "" || name == socket.name) {
+			socket.used = true
+			files = append(files, socket.file)
+		}
+	}
+	if len(files) == 0 && name == "" {
+		return nil, errors.New("all sockets passed by systemd are in use")
+	} else if len(files) == 0 {
+		return nil, errors.New("no socket named " + name + " passed by systemd")
+	}
+	return files, nil
+}
+
+// multiListener 将多个监听合并为一个, 供只接收一个 listener 的 IServer.Run 使用
+type multiListener struct {
+	listeners []net.Listener
+	accepted  chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{listeners: listeners, accepted: make(chan acceptResult), done: make(chan struct{})}
+	for _, l := range listeners {
+		go m.accept(l)
+	}
+	return m
+}
+
+func (m *multiListener) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case m.accepted <- acceptResult{conn: conn, err: err}:
+		case <-m.done:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-m.accepted:
+		return r.conn, r.err
+	case <-m.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() (err error) {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, l := range m.listeners {
+			if e := l.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return
+}
+
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
+
+// listenerFiles 返回监听的 socket 文件, 用于平滑重启时传给新进程
+func listenerFiles(l net.Listener) (files []*os.File) {
+	listeners := []net.Listener{l}
+	if m, ok := l.(*multiListener); ok {
+		listeners = m.listeners
+	}
+	for _, l := range listeners {
+		if f, ok := l.(filer); ok {
+			if file, err := f.File(); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	return
+}
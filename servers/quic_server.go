@@ -31,7 +31,9 @@ type quicInstance struct {
 	isClose     bool
 	actions     map[string]*play.ActionUnit
 	sortedNames []string
+	compress    *play.CompressPolicy
 	quicServer  *quic.Listener
+	concurrency int
 }
 
 func NewQuicInstance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *quicInstance {
@@ -85,13 +87,19 @@ func (i *quicInstance) Transport(conn *play.Conn, data []byte) (err error) {
 	return err
 }
 
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *quicInstance) WithCompression(policy play.CompressPolicy) *quicInstance {
+	i.compress = &policy
+	return i
+}
+
 func (i *quicInstance) Network() string {
 	return "udp"
 }
 
 func (i *quicInstance) Run(listener net.Listener, udplistener net.PacketConn) (err error) {
-	var tlsconfig *tls.Config
-	if i.tlsconfig == nil {
+	var tlsconfig = i.tlsconfig
+	if tlsconfig == nil {
 		tlsconfig = generateTLSConfig([]string{i.info.Name()})
 	}
 	i.quicServer, err = quic.Listen(udplistener, tlsconfig, i.quicConfig)
@@ -112,7 +120,8 @@ func (i *quicInstance) Run(listener net.Listener, udplistener net.PacketConn) (e
 
 		// 启用新协程处理新stream
 		go func(conn quic.Connection) {
-			s := play.NewSession(context.Background(), i)
+			// 连接关闭时会话以 play.ErrClientClosed 取消, 各 stream 上进行中的action随之退出
+			s := play.NewSession(conn.Context(), i)
 			s.Conn.Quic.Conn = conn
 			defer func() {
 				if panicInfo := recover(); panicInfo != nil {
@@ -142,6 +151,11 @@ func (i *quicInstance) Run(listener net.Listener, udplistener net.PacketConn) (e
 						ss := play.NewSession(s.Context(), i)
 						ss.Conn.Quic.Conn = conn
 						ss.Conn.Quic.Stream = stream
+						ss.Conn.Compress = i.compress
+						stop := context.AfterFunc(stream.Context(), func() {
+							ss.CloseWithCause(play.ErrClientClosed)
+						})
+						defer stop()
 
 						defer func() {
 							if panicInfo := recover(); panicInfo != nil {
@@ -171,7 +185,7 @@ func (i *quicInstance) onReadyOnce(s *play.Session) (err error) {
 
 	s.Conn.Quic.Stream.CancelRead(0)
 	s.Conn.Quic.Version = request.Version
-	if err = play.DoRequest(context.Background(), s, request); err != nil {
+	if err = play.DoRequest(s.Context(), s, request); err != nil {
 		return err
 	}
 	s.Conn.Quic.Stream = nil
@@ -179,25 +193,27 @@ func (i *quicInstance) onReadyOnce(s *play.Session) (err error) {
 }
 
 func (i *quicInstance) onReady(s *play.Session) (err error) {
-	var request *play.Request
-
-	for {
-		if i.isClose {
-			s.Conn.Quic.Stream.CancelRead(0)
-		}
-		if request, err = i.packer.Unpack(s.Conn); err != nil {
-			return
-		}
-		if request == nil {
-			continue
-		}
-		if request.Version > s.Conn.Quic.Version {
-			s.Conn.Quic.Version = request.Version
-		}
-		if err = play.DoRequest(context.Background(), s, request); err != nil {
-			return
+	// 读取与处理并行, 在连接的副本上解包; 协议版本升级时在写锁内同步给之后的响应
+	var reader = *s.Conn
+	return serveRequests(s, i.concurrency, func() (*play.Request, error) {
+		for {
+			if i.isClose {
+				reader.Quic.Stream.CancelRead(0)
+			}
+			request, err := i.packer.Unpack(&reader)
+			if err != nil {
+				return nil, err
+			}
+			if request == nil {
+				continue
+			}
+			if version := request.Version; version > reader.Quic.Version {
+				reader.Quic.Version = version
+				s.UpdateConn(func(c *play.Conn) { c.Quic.Version = version })
+			}
+			return request, nil
 		}
-	}
+	})
 }
 
 func (i *quicInstance) Close() {
@@ -210,6 +226,11 @@ func (i *quicInstance) SetOnceStream(onceStream bool) {
 	i.onceStream = onceStream
 }
 
+// SetConcurrency 非 onceStream 模式下, 同一条流上携带 requestId 的请求最多由 n 个协程并发处理
+func (i *quicInstance) SetConcurrency(n int) {
+	i.concurrency = n
+}
+
 func generateTLSConfig(protos []string) *tls.Config {
 	key, err := rsa.GenerateKey(rand.Reader, 1024)
 	if err != nil {
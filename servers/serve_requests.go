@@ -0,0 +1,159 @@
+package servers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/leochen2038/play"
+	"github.com/quic-go/quic-go"
+)
+
+// serveRequests 在独立协程中持续读取请求并处理, 处理期间仍能感知连接断开:
+// 读取失败时以 play.ErrClientClosed 关闭会话, 进行中的action通过 ctx.Err() 及时退出
+// concurrency > 1 时携带 RequestId 的请求交由最多 concurrency 个协程并发处理, 响应按完成顺序写出;
+// 未携带 RequestId 的请求(旧版客户端)仍在读取顺序上逐个处理, 保证响应先进先出;
+// 取消请求由读取协程直接处理, 以 play.ErrRequestCanceled 取消 RequestId 相同的进行中请求
+func serveRequests(s *play.Session, concurrency int, next func() (*play.Request, error)) error {
+	var requests = make(chan *play.Request)
+	var readErr = make(chan error, 1)
+	var workers = make(chan struct{}, max(concurrency, 1))
+	var inflight = inflightRequests{requests: make(map[string]*inflightRequest)}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		defer close(requests)
+		for {
+			request, err := next()
+			if err == nil && request.Cancel {
+				inflight.cancel(request.RequestId)
+				continue
+			}
+			if err == nil {
+				inflight.add(s, request)
+			}
+			if err != nil {
+				readErr <- err
+				if isClientClosed(err) {
+					s.CloseWithCause(play.ErrClientClosed)
+				} else {
+					s.CloseWithCause(err)
+				}
+				return
+			}
+			select {
+			case requests <- request:
+			case <-s.Context().Done():
+				readErr <- context.Cause(s.Context())
+				return
+			}
+		}
+	}()
+
+	for {
+		var request *play.Request
+		var ok bool
+		select {
+		case request, ok = <-requests:
+		case <-s.Context().Done():
+			ok = false
+		}
+		if !ok {
+			select {
+			case err := <-readErr:
+				return err
+			default:
+				// 处理协程出错关闭了会话, 读取协程可能仍阻塞在读取上, 由调用方关闭连接
+				return context.Cause(s.Context())
+			}
+		}
+
+		if concurrency <= 1 || request.RequestId == "" {
+			if err := inflight.do(s, request); err != nil {
+				s.CloseWithCause(err)
+				return err
+			}
+			continue
+		}
+
+		select {
+		case workers <- struct{}{}:
+		case <-s.Context().Done():
+			return context.Cause(s.Context())
+		}
+		wg.Add(1)
+		go func(request *play.Request) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if err := inflight.do(s, request); err != nil {
+				s.CloseWithCause(err)
+			}
+		}(request)
+	}
+}
+
+// inflightRequests 连接上携带 RequestId 的请求, 读取时登记, 保证紧随其后的取消帧能找到对应请求
+type inflightRequests struct {
+	mu       sync.Mutex
+	requests map[string]*inflightRequest
+}
+
+type inflightRequest struct {
+	request *play.Request
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+}
+
+func (r *inflightRequests) add(s *play.Session, request *play.Request) {
+	if request.RequestId == "" {
+		return
+	}
+	ctx, cancel := context.WithCancelCause(s.Context())
+	r.mu.Lock()
+	r.requests[request.RequestId] = &inflightRequest{request: request, ctx: ctx, cancel: cancel}
+	r.mu.Unlock()
+}
+
+// do 已登记的请求在可单独取消的 ctx 中处理
+func (r *inflightRequests) do(s *play.Session, request *play.Request) error {
+	r.mu.Lock()
+	e := r.requests[request.RequestId]
+	r.mu.Unlock()
+	if e == nil || e.request != request {
+		return play.DoRequest(s.Context(), s, request)
+	}
+	defer func() {
+		r.mu.Lock()
+		if r.requests[request.RequestId] == e {
+			delete(r.requests, request.RequestId)
+		}
+		r.mu.Unlock()
+		e.cancel(nil)
+	}()
+	return play.DoRequest(e.ctx, s, request)
+}
+
+func (r *inflightRequests) cancel(requestId string) {
+	r.mu.Lock()
+	e := r.requests[requestId]
+	r.mu.Unlock()
+	if e != nil {
+		e.cancel(play.ErrRequestCanceled)
+	}
+}
+
+// isClientClosed 判断读取错误是否由对端断开引起, 其它错误(如协议错误)作为关闭原因原样返回
+func isClientClosed(err error) bool {
+	var streamErr *quic.StreamError
+	var appErr *quic.ApplicationError
+	var idleErr *quic.IdleTimeoutError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &streamErr) || errors.As(err, &appErr) || errors.As(err, &idleErr)
+}
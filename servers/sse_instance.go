@@ -10,9 +10,12 @@ import (
 	"net/http"
 	"runtime/debug"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/leochen2038/play"
+	"github.com/leochen2038/play/codec/compressors"
 	"github.com/leochen2038/play/packers"
 )
 
@@ -23,10 +26,29 @@ type sseInstance struct {
 	packer      play.IPacker
 	actions     map[string]*play.ActionUnit
 	sortedNames []string
+	compress    *play.CompressPolicy
+	cors        *CorsPolicy
 	tlsConfig   *tls.Config
 	httpServer  http.Server
+	keepalive   time.Duration
+	retry       time.Duration
+	replay      SseReplayBuffer
+	queueSize   int
+	mu          sync.Mutex
+	channels    map[string]map[*sseSubscriber]struct{}
+	sessions    map[string]*sseSubscriber
+	seq         map[string]uint64
 }
 
+// sseSubscriber 一个打开的事件流, 推送的事件经队列由连接自身的协程按顺序写出
+type sseSubscriber struct {
+	sess     *play.Session
+	channels []string
+	events   chan *play.Response
+}
+
+var errSseSlowConsumer = errors.New("sse event queue is full")
+
 func NewSSEInstance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *sseInstance {
 	if packer == nil {
 		packer = packers.NewJsonPacker()
@@ -37,7 +59,146 @@ func NewSSEInstance(name string, addr string, hook play.IServerHook, packer play
 	if defaultActionTimeout == 0 {
 		defaultActionTimeout = defaultTimeout
 	}
-	return &sseInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_SSE, defaultActionTimeout), packer: packer, hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit)}
+	return &sseInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_SSE, defaultActionTimeout), packer: packer, hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit),
+		cors: &CorsPolicy{AllowOrigins: []string{"*"}}, keepalive: 15 * time.Second, queueSize: 256,
+		channels: make(map[string]map[*sseSubscriber]struct{}), sessions: make(map[string]*sseSubscriber), seq: make(map[string]uint64)}
+}
+
+// WithKeepalive 连接空闲时每隔 interval 发送注释行, 防止代理断开连接, 默认15s, 0 不发送
+func (i *sseInstance) WithKeepalive(interval time.Duration) *sseInstance {
+	i.keepalive = interval
+	return i
+}
+
+// WithRetry 连接建立时告知客户端断线后的重连间隔
+func (i *sseInstance) WithRetry(retry time.Duration) *sseInstance {
+	i.retry = retry
+	return i
+}
+
+// WithReplayBuffer 保存推送的事件, 客户端携带 Last-Event-ID 重连时补发之后的事件
+func (i *sseInstance) WithReplayBuffer(buffer SseReplayBuffer) *sseInstance {
+	i.replay = buffer
+	return i
+}
+
+// WithQueueSize 每个连接待写出的推送事件上限, 超出时断开该连接, 默认256
+func (i *sseInstance) WithQueueSize(size int) *sseInstance {
+	i.queueSize = max(size, 1)
+	return i
+}
+
+// Push 向订阅 channel 的所有连接推送事件, 返回事件 id; 连接默认订阅其请求的 action 名
+func (i *sseInstance) Push(channel string, res *play.Response) string {
+	var event = *res
+	if event.Event == nil {
+		event.Event = &play.ServerEvent{}
+	} else {
+		e := *event.Event
+		event.Event = &e
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.replay != nil {
+		i.replay.Append(channel, &event)
+	} else if event.Event.Id == "" {
+		i.seq[channel]++
+		event.Event.Id = strconv.FormatUint(i.seq[channel], 10)
+	}
+	for sub := range i.channels[channel] {
+		i.enqueue(sub, &event)
+	}
+	return event.Event.Id
+}
+
+// Publish 以 name 为事件名向 channel 推送 data
+func (i *sseInstance) Publish(channel string, name string, data map[string]interface{}) string {
+	var res = play.Response{Event: &play.ServerEvent{Name: name}}
+	for k, v := range data {
+		res.Output.Set(k, v)
+	}
+	return i.Push(channel, &res)
+}
+
+// PushTo 向指定会话推送事件, 会话不存在时返回 false
+func (i *sseInstance) PushTo(sessId string, res *play.Response) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	sub := i.sessions[sessId]
+	if sub == nil {
+		return false
+	}
+	i.enqueue(sub, res)
+	return true
+}
+
+// Subscribe 使会话额外订阅若干频道, 可在 processor 中通过 ctx.Session 调用
+func (i *sseInstance) Subscribe(sess *play.Session, channels ...string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if sub := i.sessions[sess.SessId]; sub != nil {
+		i.join(sub, channels...)
+	}
+}
+
+// enqueue 调用方持有 i.mu, 每个连接写出各自的副本; 队列满时断开连接
+func (i *sseInstance) enqueue(sub *sseSubscriber, res *play.Response) {
+	var event = *res
+	select {
+	case sub.events <- &event:
+	default:
+		sub.sess.CloseWithCause(errSseSlowConsumer)
+	}
+}
+
+// join 调用方持有 i.mu
+func (i *sseInstance) join(sub *sseSubscriber, channels ...string) {
+	for _, channel := range channels {
+		if i.channels[channel] == nil {
+			i.channels[channel] = make(map[*sseSubscriber]struct{})
+		}
+		i.channels[channel][sub] = struct{}{}
+		sub.channels = append(sub.channels, channel)
+	}
+}
+
+// subscribe 订阅频道并把 Last-Event-ID 之后的事件放入队列, 在同一把锁内完成以免与推送交错
+func (i *sseInstance) subscribe(sess *play.Session, channel string) *sseSubscriber {
+	var sub = &sseSubscriber{sess: sess, events: make(chan *play.Response, i.queueSize)}
+	var lastEventId = sess.Conn.Http.Request.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = sess.Conn.Http.Request.URL.Query().Get("lastEventId")
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.replay != nil && lastEventId != "" {
+		for _, res := range i.replay.Since(channel, lastEventId) {
+			i.enqueue(sub, res)
+		}
+	}
+	i.sessions[sess.SessId] = sub
+	i.join(sub, channel)
+	return sub
+}
+
+func (i *sseInstance) unsubscribe(sub *sseSubscriber) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.sessions, sub.sess.SessId)
+	for _, channel := range sub.channels {
+		delete(i.channels[channel], sub)
+		if len(i.channels[channel]) == 0 {
+			delete(i.channels, channel)
+		}
+	}
+}
+
+// WithCors 设置跨域策略, 默认允许所有 Origin, 设为 nil 时不输出跨域响应头
+func (i *sseInstance) WithCors(policy *CorsPolicy) *sseInstance {
+	i.cors = policy
+	return i
 }
 
 func (i *sseInstance) WithCertificate(cert tls.Certificate) *sseInstance {
@@ -57,6 +218,14 @@ func (i *sseInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		recover()
 	}()
 
+	if err = i.checkOrigin(w, r); err != nil {
+		i.hook.OnConnect(sess, err)
+		return
+	}
+	if i.cors != nil && i.cors.handle(w, r) {
+		return
+	}
+
 	if err = i.update(r); err != nil {
 		i.hook.OnConnect(sess, err)
 		return
@@ -66,6 +235,15 @@ func (i *sseInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	i.accept(sess)
 }
 
+// checkOrigin 设置了跨域策略时拒绝 Origin 不在允许列表中的请求, 返回403
+func (i *sseInstance) checkOrigin(w http.ResponseWriter, r *http.Request) error {
+	if i.cors == nil || i.cors.CheckOrigin(r) {
+		return nil
+	}
+	http.Error(w, "Origin not allowed", http.StatusForbidden)
+	return errors.New("origin not allowed:" + r.Header.Get("Origin"))
+}
+
 func (i *sseInstance) update(r *http.Request) error {
 	accept := r.Header["Accept"]
 	if !(len(accept) > 0 && accept[0] == "text/event-stream") {
@@ -95,23 +273,70 @@ func (i *sseInstance) accept(s *play.Session) {
 		return
 	}
 
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.Header().Set("X-Accel-Buffering", "no")
 
+	if i.compress != nil {
+		if c := compressors.Negotiate(s.Conn.Http.Request.Header.Get("Accept-Encoding"), i.compress.Encodings); c != nil {
+			var cw compressors.Writer
+			if cw, err = c.NewWriter(w); err != nil {
+				return
+			}
+			w.Header().Set("Content-Encoding", c.Name())
+			w.Header().Add("Vary", "Accept-Encoding")
+			s.Conn.Http.ResponseWriter = &compressResponseWriter{ResponseWriter: w, writer: cw}
+			defer cw.Close()
+		}
+	}
+
 	request, err := i.packer.Unpack(s.Conn)
 	if err != nil {
 		return
 	}
 
-	if err = play.DoRequest(context.Background(), s, request); err != nil {
+	sub := i.subscribe(s, request.ActionName)
+	defer i.unsubscribe(sub)
+
+	if err = play.DoRequest(s.Context(), s, request); err != nil {
 		return
 	}
+	if i.retry > 0 {
+		if err = s.WriteRaw([]byte("retry: " + strconv.FormatInt(i.retry.Milliseconds(), 10) + "\n\n")); err != nil {
+			return
+		}
+	}
+	err = i.serveEvents(s, sub)
+}
+
+// serveEvents 写出推送的事件并定时发送心跳注释, 直到连接断开
+func (i *sseInstance) serveEvents(s *play.Session, sub *sseSubscriber) error {
+	var keepalive <-chan time.Time
+	if i.keepalive > 0 {
+		ticker := time.NewTicker(i.keepalive)
+		defer ticker.Stop()
+		keepalive = ticker.C
+	}
 
-	<-s.Context().Done()
+	for {
+		select {
+		case <-s.Context().Done():
+			if cause := context.Cause(s.Context()); cause != nil && cause != context.Canceled && !errors.Is(cause, play.ErrClientClosed) {
+				return cause
+			}
+			return nil
+		case res := <-sub.events:
+			if err := s.Write(res); err != nil {
+				return err
+			}
+		case <-keepalive:
+			if err := s.WriteRaw([]byte(": keepalive\n\n")); err != nil {
+				return err
+			}
+		}
+	}
 }
 
 func (i *sseInstance) Run(listener net.Listener, udplistener net.PacketConn) error {
@@ -140,14 +365,41 @@ func (i *sseInstance) Packer() play.IPacker {
 }
 
 func (i *sseInstance) Transport(conn *play.Conn, data []byte) error {
+	if _, err := conn.Http.ResponseWriter.Write(data); err != nil {
+		return err
+	}
 	conn.Http.ResponseWriter.(http.Flusher).Flush()
 	return nil
 }
 
+// compressResponseWriter 对事件流做流式压缩, 每次 Flush 都把已写入的事件压缩后推送给客户端
+type compressResponseWriter struct {
+	http.ResponseWriter
+	writer compressors.Writer
+}
+
+func (w *compressResponseWriter) Write(data []byte) (int, error) {
+	return w.writer.Write(data)
+}
+
+func (w *compressResponseWriter) Flush() {
+	if err := w.writer.Flush(); err == nil {
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
 func (i *sseInstance) Ctrl() *play.InstanceCtrl {
 	return i.ctrl
 }
 
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *sseInstance) WithCompression(policy play.CompressPolicy) *sseInstance {
+	i.compress = &policy
+	return i
+}
+
 func (i *sseInstance) Network() string {
 	return "tcp"
 }
@@ -0,0 +1,86 @@
+package servers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSEInstanceCors(t *testing.T) {
+	policy := &CorsPolicy{AllowOrigins: []string{"https://a.example"}}
+	tests := []struct {
+		name     string
+		mounted  bool
+		httpCors *CorsPolicy
+		method   string
+		origin   string
+		status   int
+		allow    string
+	}{
+		{name: "allowed", origin: "https://a.example", status: http.StatusOK, allow: "https://a.example"},
+		{name: "no origin", status: http.StatusOK},
+		{name: "forbidden", origin: "https://b.example", status: http.StatusForbidden},
+		{name: "preflight", method: http.MethodOptions, origin: "https://a.example", status: http.StatusNoContent, allow: "https://a.example"},
+		{name: "mounted", mounted: true, origin: "https://a.example", status: http.StatusOK, allow: "https://a.example"},
+		{name: "mounted forbidden", mounted: true, origin: "https://b.example", status: http.StatusForbidden},
+		{name: "mounted with http cors", mounted: true, httpCors: &CorsPolicy{AllowOrigins: []string{"*"}}, origin: "https://a.example", status: http.StatusOK, allow: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sse := NewSSEInstance("sse", "", nil, nil, 0).WithKeepalive(0).WithCors(policy)
+			if err := sse.BindActionSpace("", "servertest"); err != nil {
+				t.Fatal(err)
+			}
+			var handler http.Handler = sse
+			if tt.mounted {
+				i := NewHttpInstance("http", "", nil, nil, 0)
+				if tt.httpCors != nil {
+					i.WithCors(tt.httpCors)
+				}
+				i.SetSSEInstance(sse)
+				handler = i
+			}
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, _ := http.NewRequestWithContext(ctx, method, srv.URL+"/hello", nil)
+			req.Header.Set("Accept", "text/event-stream")
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			// 跨域响应头只写入一次
+			if allow := resp.Header.Values("Access-Control-Allow-Origin"); len(allow) > 1 || (tt.allow != "" && (len(allow) != 1 || allow[0] != tt.allow)) {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", allow, tt.allow)
+			}
+			var vary int
+			for _, v := range resp.Header.Values("Vary") {
+				if v == "Origin" {
+					vary++
+				}
+			}
+			if vary > 1 {
+				t.Fatalf("Vary = %q", resp.Header.Values("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package servers
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/leochen2038/play"
+)
+
+// SseReplayBuffer 保存推送到频道的事件, 客户端携带 Last-Event-ID 重连时补发之后的事件
+// 多实例部署时可基于 redis 等共享存储实现, 保证事件 id 在实例间一致
+type SseReplayBuffer interface {
+	// Append 为事件分配 id 并写入 res.Event.Id, 保存后返回该 id; res 在之后不会被修改
+	Append(channel string, res *play.Response) string
+	// Since 返回 lastEventId 之后的事件, lastEventId 已不在缓冲区时返回缓冲区中的全部事件
+	Since(channel string, lastEventId string) []*play.Response
+}
+
+type memoryReplayBuffer struct {
+	size     int
+	mu       sync.Mutex
+	channels map[string]*replayRing
+}
+
+type replayRing struct {
+	seq    uint64
+	events []*play.Response
+}
+
+// NewMemoryReplayBuffer 每个频道在内存中保留最近 size 个事件, 事件 id 为频道内递增的序号
+func NewMemoryReplayBuffer(size int) SseReplayBuffer {
+	if size <= 0 {
+		size = 100
+	}
+	return &memoryReplayBuffer{size: size, channels: make(map[string]*replayRing)}
+}
+
+func (b *memoryReplayBuffer) Append(channel string, res *play.Response) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ring := b.channels[channel]
+	if ring == nil {
+		ring = &replayRing{}
+		b.channels[channel] = ring
+	}
+	ring.seq++
+	id := strconv.FormatUint(ring.seq, 10)
+	if res.Event == nil {
+		res.Event = &play.ServerEvent{}
+	}
+	res.Event.Id = id
+	if len(ring.events) >= b.size {
+		ring.events = append(ring.events[:0:0], ring.events[len(ring.events)-b.size+1:]...)
+	}
+	ring.events = append(ring.events, res)
+	return id
+}
+
+func (b *memoryReplayBuffer) Since(channel string, lastEventId string) []*play.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ring := b.channels[channel]
+	if ring == nil {
+		return nil
+	}
+	last, err := strconv.ParseUint(lastEventId, 10, 64)
+	if err != nil || last >= ring.seq {
+		return nil
+	}
+	first := ring.seq - uint64(len(ring.events)) + 1
+	if last < first {
+		return append([]*play.Response(nil), ring.events...)
+	}
+	return append([]*play.Response(nil), ring.events[last-first+1:]...)
+}
@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/leochen2038/play"
+)
+
+func TestMemoryReplayBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		appends int
+		channel string
+		last    string
+		want    []string
+	}{
+		{name: "after last", size: 5, appends: 3, channel: "c", last: "1", want: []string{"2", "3"}},
+		{name: "up to date", size: 5, appends: 3, channel: "c", last: "3"},
+		{name: "ahead", size: 5, appends: 3, channel: "c", last: "9"},
+		{name: "oldest kept", size: 3, appends: 5, channel: "c", last: "2", want: []string{"3", "4", "5"}},
+		{name: "evicted", size: 3, appends: 5, channel: "c", last: "1", want: []string{"3", "4", "5"}},
+		{name: "inside window", size: 3, appends: 5, channel: "c", last: "3", want: []string{"4", "5"}},
+		{name: "invalid id", size: 3, appends: 2, channel: "c", last: "abc"},
+		{name: "unknown channel", size: 3, appends: 2, channel: "other", last: "0"},
+		{name: "default size", appends: 120, channel: "c", last: "0", want: seqIds(21, 120)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryReplayBuffer(tt.size)
+			for i := 1; i <= tt.appends; i++ {
+				res := &play.Response{}
+				id := b.Append("c", res)
+				if id != strconv.Itoa(i) || res.Event.Id != id {
+					t.Fatalf("append %d: id = %q, event id = %q", i, id, res.Event.Id)
+				}
+			}
+			// 其他频道的序号独立
+			if id := b.Append("c2", &play.Response{}); id != "1" {
+				t.Fatalf("other channel id = %q, want 1", id)
+			}
+
+			var got []string
+			for _, res := range b.Since(tt.channel, tt.last) {
+				got = append(got, res.Event.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("since %s = %v, want %v", tt.last, got, tt.want)
+			}
+		})
+	}
+}
+
+func seqIds(from, to int) []string {
+	var ids []string
+	for i := from; i <= to; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	return ids
+}
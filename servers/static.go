@@ -0,0 +1,102 @@
+package servers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/leochen2038/play/packers"
+)
+
+// staticHandler 将 prefix 下的请求映射到 fsys 中的文件, 支持 os.DirFS / embed.FS / fstest.MapFS 等
+type staticHandler struct {
+	prefix string
+	fsys   fs.FS
+	etags  sync.Map // 无修改时间的文件(如 embed.FS)按内容摘要生成 ETag
+}
+
+func newStaticHandler(prefix string, fsys fs.FS) *staticHandler {
+	return &staticHandler{prefix: "/" + strings.Trim(prefix, "/"), fsys: fsys}
+}
+
+// serve 请求路径不在 prefix 下或文件不存在时返回 false, 交由 action 处理
+func (h *staticHandler) serve(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+	if h.prefix != "/" {
+		if urlPath != h.prefix && !strings.HasPrefix(urlPath, h.prefix+"/") {
+			return false
+		}
+		urlPath = strings.TrimPrefix(urlPath, h.prefix)
+	}
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return false
+	}
+
+	f, info, err := h.open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+	if info.ModTime().IsZero() {
+		if etag := h.contentETag(name, content); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+	}
+	packers.ServeContent(w, r, info.Name(), info.ModTime(), info.Size(), content)
+	return true
+}
+
+// open 打开文件, 目录使用其中的 index.html
+func (h *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	for i := 0; i < 2; i++ {
+		f, err := h.fsys.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			return f, info, nil
+		}
+		f.Close()
+		name = path.Join(name, "index.html")
+	}
+	return nil, nil, fs.ErrNotExist
+}
+
+func (h *staticHandler) contentETag(name string, content io.ReadSeeker) string {
+	if etag, ok := h.etags.Load(name); ok {
+		return etag.(string)
+	}
+	hash := sha1.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return ""
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:10]) + `"`
+	h.etags.Store(name, etag)
+	return etag
+}
@@ -20,7 +20,9 @@ type tcpInstance struct {
 	ctrl        *play.InstanceCtrl
 	actions     map[string]*play.ActionUnit
 	sortedNames []string
+	compress    *play.CompressPolicy
 	packer      play.IPacker
+	concurrency int
 }
 
 func NewTcpInstance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *tcpInstance {
@@ -37,36 +39,33 @@ func NewTcpInstance(name string, addr string, hook play.IServerHook, packer play
 }
 
 func (i *tcpInstance) onReady(s *play.Session) (err error) {
-	var n int
 	var buffer = make([]byte, 4096)
-	var request *play.Request
 	var conn = s.Conn.Tcp.Conn
 
-	for {
-		sessContext := s.Context()
-		select {
-		case <-sessContext.Done():
-			return sessContext.Err()
-		default:
-			if n, err = conn.Read(buffer); err != nil {
-				return
-			}
-			s.Conn.Tcp.Surplus = append(s.Conn.Tcp.Surplus, buffer[:n]...)
-			if request, err = i.packer.Unpack(s.Conn); err != nil {
-				return
-			}
-			if request == nil {
-				continue
-			} else {
-				if request.Version > s.Conn.Tcp.Version {
-					s.Conn.Tcp.Version = request.Version
+	// 读取与处理并行, 在连接的副本上缓存未解包的数据; 协议版本升级时在写锁内同步给之后的响应
+	var reader = *s.Conn
+	return serveRequests(s, i.concurrency, func() (*play.Request, error) {
+		for {
+			if len(reader.Tcp.Surplus) > 0 {
+				request, err := i.packer.Unpack(&reader)
+				if err != nil {
+					return nil, err
 				}
-				if err = play.DoRequest(context.Background(), s, request); err != nil {
-					return err
+				if request != nil {
+					if version := request.Version; version > reader.Tcp.Version {
+						reader.Tcp.Version = version
+						s.UpdateConn(func(c *play.Conn) { c.Tcp.Version = version })
+					}
+					return request, nil
 				}
 			}
+			n, err := conn.Read(buffer)
+			if err != nil {
+				return nil, err
+			}
+			reader.Tcp.Surplus = append(reader.Tcp.Surplus, buffer[:n]...)
 		}
-	}
+	})
 }
 
 func (i *tcpInstance) Info() play.IInstanceInfo {
@@ -103,6 +102,7 @@ func (i *tcpInstance) Run(listener net.Listener, udplistener net.PacketConn) err
 		go func(err error, conn net.Conn) {
 			s := play.NewSession(context.Background(), i)
 			s.Conn.Tcp.Conn = conn
+			s.Conn.Compress = i.compress
 
 			defer func() {
 				if panicInfo := recover(); panicInfo != nil {
@@ -129,6 +129,19 @@ func (i *tcpInstance) Close() {
 	i.ctrl.WaitTask()
 }
 
+// WithCompression 开启响应压缩, 按请求方支持的算法协商
+func (i *tcpInstance) WithCompression(policy play.CompressPolicy) *tcpInstance {
+	i.compress = &policy
+	return i
+}
+
+// WithConcurrency 单个连接上携带 requestId 的请求最多由 n 个协程并发处理, 响应按完成顺序返回;
+// n <= 1 或请求未携带 requestId 时按顺序处理
+func (i *tcpInstance) WithConcurrency(n int) *tcpInstance {
+	i.concurrency = n
+	return i
+}
+
 func (i *tcpInstance) Network() string {
 	return "tcp"
 }
@@ -0,0 +1,85 @@
+package servers
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leochen2038/play/codec/protos/pproto"
+)
+
+func TestTcpInstancePipelining(t *testing.T) {
+	i := NewTcpInstance("tcp", "", nil, nil, 0).WithConcurrency(4)
+	if err := i.BindActionSpace("", "servertest"); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go i.Run(ln, nil)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 首个 v4 请求按顺序处理, 之后的 v5 请求在读取的同时并发处理, 连接版本随之升级
+	requests := []pproto.PlayProtocolRequest{{Version: 4, Action: "hello", Body: []byte(`{"name":"v4"}`)}}
+	for k := 1; k <= 20; k++ {
+		requests = append(requests, pproto.PlayProtocolRequest{Version: 5, RequestId: uint64(k), Action: "hello", Body: []byte(`{"name":"` + strconv.Itoa(k) + `"}`)})
+	}
+	var data []byte
+	for _, request := range requests {
+		frame, err := pproto.MarshalProtocolRequest(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, frame...)
+	}
+	if _, err = conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer []byte
+	var got = make(map[uint64]string)
+	for len(got) < len(requests) {
+		chunk := make([]byte, 4096)
+		n, err := conn.Read(chunk)
+		if err != nil {
+			t.Fatalf("read after %d responses: %v", len(got), err)
+		}
+		buffer = append(buffer, chunk[:n]...)
+		for {
+			response, size, err := pproto.UnmarshalProtocolResponse(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size == 0 {
+				break
+			}
+			buffer = buffer[size:]
+			if response.Version == 4 {
+				response.RequestId = 0
+			} else if response.Version != 5 {
+				t.Fatalf("response version = %d", response.Version)
+			}
+			got[response.RequestId] = string(response.Body)
+		}
+	}
+
+	for k, request := range requests {
+		name := "v4"
+		if k > 0 {
+			name = strconv.Itoa(k)
+		}
+		if body := got[request.RequestId]; !strings.Contains(body, `"msg":"hello `+name+`"`) {
+			t.Fatalf("response %d = %s", request.RequestId, body)
+		}
+	}
+}
@@ -1,15 +1,17 @@
 package servers
 
 import (
-	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"runtime/debug"
 	"sort"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,9 +19,9 @@ import (
 	"github.com/leochen2038/play/packers"
 )
 
-var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
-	return true
-}}
+var errNotWebsocket = errors.New("err websocket connect")
+var errWsIdleTimeout = errors.New("websocket idle timeout")
+var errWsHeartbeatTimeout = errors.New("websocket heartbeat timeout")
 
 type wsInstance struct {
 	info        play.IInstanceInfo
@@ -30,6 +32,16 @@ type wsInstance struct {
 	sortedNames []string
 	tlsConfig   *tls.Config
 	httpServer  http.Server
+	upgrader    websocket.Upgrader
+	cors        *CorsPolicy
+	concurrency int
+
+	pingInterval     time.Duration
+	pongTimeout      time.Duration
+	idleTimeout      time.Duration
+	readLimit        int64
+	writeTimeout     time.Duration
+	compressionLevel int
 }
 
 func NewWsInstance(name string, addr string, hook play.IServerHook, packer play.IPacker, defaultActionTimeout time.Duration) *wsInstance {
@@ -42,8 +54,69 @@ func NewWsInstance(name string, addr string, hook play.IServerHook, packer play.
 	if defaultActionTimeout == 0 {
 		defaultActionTimeout = defaultTimeout
 	}
-	return &wsInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_WS, defaultActionTimeout), packer: packer,
+	i := &wsInstance{info: play.NewInstanceInfo(name, addr, play.SERVER_TYPE_WS, defaultActionTimeout), packer: packer,
 		hook: hook, ctrl: new(play.InstanceCtrl), actions: make(map[string]*play.ActionUnit)}
+	i.upgrader.CheckOrigin = i.checkOrigin
+	return i
+}
+
+// checkOrigin 未设置跨域策略时不限制 Origin
+func (i *wsInstance) checkOrigin(r *http.Request) bool {
+	return i.cors == nil || i.cors.CheckOrigin(r)
+}
+
+// WithCors 设置跨域策略, 升级时校验 Origin, 不在允许列表中的请求返回403
+func (i *wsInstance) WithCors(policy *CorsPolicy) *wsInstance {
+	i.cors = policy
+	return i
+}
+
+// WithConcurrency 单个连接上携带 requestId 的消息最多由 n 个协程并发处理, 响应中回传 requestId;
+// n <= 1 或消息未携带 requestId 时按顺序处理
+func (i *wsInstance) WithConcurrency(n int) *wsInstance {
+	i.concurrency = n
+	return i
+}
+
+// WithHeartbeat 每隔 interval 发送 ping, 超过 interval+timeout 未收到任何数据时断开连接; timeout 为0时使用 interval
+// hook 实现 play.IHeartbeatHook 时, 收到 pong 后调用 OnHeartbeat
+func (i *wsInstance) WithHeartbeat(interval time.Duration, timeout time.Duration) *wsInstance {
+	if timeout <= 0 {
+		timeout = interval
+	}
+	i.pingInterval, i.pongTimeout = interval, timeout
+	return i
+}
+
+// WithIdleTimeout 超过 timeout 未收到业务消息时断开连接, 心跳不算作活动; hook 实现 play.IHeartbeatHook 时先调用 OnIdle
+func (i *wsInstance) WithIdleTimeout(timeout time.Duration) *wsInstance {
+	i.idleTimeout = timeout
+	return i
+}
+
+// WithReadLimit 单条消息最大字节数, 超出时以 1009 关闭连接
+func (i *wsInstance) WithReadLimit(limit int64) *wsInstance {
+	i.readLimit = limit
+	return i
+}
+
+// WithWriteTimeout 单条消息的写超时
+func (i *wsInstance) WithWriteTimeout(timeout time.Duration) *wsInstance {
+	i.writeTimeout = timeout
+	return i
+}
+
+// WithCompression 与客户端协商 permessage-deflate, level 为 flate 压缩级别, 0 时使用默认级别
+func (i *wsInstance) WithCompression(level int) *wsInstance {
+	i.upgrader.EnableCompression = true
+	i.compressionLevel = level
+	return i
+}
+
+// WithBufferSize 设置读写缓冲区大小, 默认 4KB
+func (i *wsInstance) WithBufferSize(readBufferSize int, writeBufferSize int) *wsInstance {
+	i.upgrader.ReadBufferSize, i.upgrader.WriteBufferSize = readBufferSize, writeBufferSize
+	return i
 }
 
 func (i *wsInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -83,9 +156,11 @@ func (i *wsInstance) accept(s *play.Session) {
 		i.hook.OnClose(s, err)
 	}()
 	i.hook.OnConnect(s, nil)
+	i.setupConn(s, s.Conn.Websocket.WebsocketConn)
 
+	defer s.Conn.Websocket.WebsocketConn.Close()
 	if request, err = i.packer.Unpack(s.Conn); request != nil {
-		if err = play.DoRequest(context.Background(), s, request); err != nil {
+		if err = play.DoRequest(s.Context(), s, request); err != nil {
 			return
 		}
 	}
@@ -94,25 +169,123 @@ func (i *wsInstance) accept(s *play.Session) {
 }
 
 func (i *wsInstance) onReady(sess *play.Session) error {
-	for {
-		sessContext := sess.Context()
-		select {
-		case <-sessContext.Done():
-			return sessContext.Err()
-		default:
-			messageType, message, err := sess.Conn.Websocket.WebsocketConn.ReadMessage()
-			if err != nil {
-				return err
+	var conn = sess.Conn.Websocket.WebsocketConn
+	var lastActive atomic.Int64
+	var idle atomic.Bool
+	lastActive.Store(time.Now().UnixNano())
+
+	if i.pingInterval > 0 || i.idleTimeout > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go i.keepalive(sess, &lastActive, &idle, done)
+	}
+
+	return serveRequests(sess, i.concurrency, func() (*play.Request, error) {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if idle.Load() {
+				return nil, errWsIdleTimeout
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, errWsHeartbeatTimeout
 			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		lastActive.Store(time.Now().UnixNano())
+		i.extendReadDeadline(conn)
+
+		// 读取与处理并行, 在连接的副本上解包, 响应经由该副本按请求消息的类型写出
+		c := *sess.Conn
+		c.Websocket.Message, c.Websocket.MessageType = message, messageType
+		request, err := i.packer.Unpack(&c)
+		if request != nil {
+			request.Conn = &c
+		}
+		return request, err
+	})
+}
+
+// setupConn 升级后设置读限制、压缩级别与心跳处理
+func (i *wsInstance) setupConn(sess *play.Session, conn *websocket.Conn) {
+	if i.readLimit > 0 {
+		conn.SetReadLimit(i.readLimit)
+	}
+	if i.compressionLevel != 0 {
+		conn.SetCompressionLevel(i.compressionLevel)
+	}
+	if i.pingInterval <= 0 {
+		return
+	}
+
+	i.extendReadDeadline(conn)
+	conn.SetPingHandler(func(data string) error {
+		i.extendReadDeadline(conn)
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(i.controlTimeout()))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(data string) error {
+		i.extendReadDeadline(conn)
+		if hook, ok := i.hook.(play.IHeartbeatHook); ok {
+			if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+				hook.OnHeartbeat(sess, time.Since(time.Unix(0, sent)))
+			}
+		}
+		return nil
+	})
+}
+
+func (i *wsInstance) extendReadDeadline(conn *websocket.Conn) {
+	if i.pingInterval > 0 {
+		conn.SetReadDeadline(time.Now().Add(i.pingInterval + i.pongTimeout))
+	}
+}
 
-			sess.Conn.Websocket.Message = message
-			sess.Conn.Websocket.MessageType = messageType
+func (i *wsInstance) controlTimeout() time.Duration {
+	if i.writeTimeout > 0 {
+		return i.writeTimeout
+	}
+	return 5 * time.Second
+}
+
+// keepalive 定时发送 ping 并检查空闲, 空闲超时时发送关闭帧并关闭连接以结束读取
+func (i *wsInstance) keepalive(sess *play.Session, lastActive *atomic.Int64, idle *atomic.Bool, done chan struct{}) {
+	var conn = sess.Conn.Websocket.WebsocketConn
+	var tick = i.pingInterval
+	if i.idleTimeout > 0 && (tick <= 0 || i.idleTimeout/4 < tick) {
+		tick = max(i.idleTimeout/4, 10*time.Millisecond)
+	}
+	var ticker = time.NewTicker(tick)
+	defer ticker.Stop()
 
-			if request, err := i.packer.Unpack(sess.Conn); err != nil {
-				return err
-			} else {
-				if err := play.DoRequest(context.Background(), sess, request); err != nil {
-					return err
+	var lastPing = time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-sess.Context().Done():
+			return
+		case now := <-ticker.C:
+			if i.idleTimeout > 0 {
+				if idleDuration := now.Sub(time.Unix(0, lastActive.Load())); idleDuration >= i.idleTimeout {
+					if hook, ok := i.hook.(play.IHeartbeatHook); ok {
+						hook.OnIdle(sess, idleDuration)
+					}
+					idle.Store(true)
+					conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout"), now.Add(i.controlTimeout()))
+					conn.Close()
+					return
+				}
+			}
+			if i.pingInterval > 0 && now.Sub(lastPing) >= i.pingInterval-tick/2 {
+				lastPing = now
+				if err := conn.WriteControl(websocket.PingMessage, []byte(strconv.FormatInt(now.UnixNano(), 10)), now.Add(i.controlTimeout())); err != nil {
+					return
 				}
 			}
 		}
@@ -121,13 +294,13 @@ func (i *wsInstance) onReady(sess *play.Session) error {
 
 func (i *wsInstance) update(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
 	if len(r.Header["Upgrade"]) == 0 {
-		return nil, errors.New("err websocket connect")
+		return nil, errNotWebsocket
 	}
 
 	if r.Header["Upgrade"][0] != "websocket" {
-		return nil, errors.New("err websocket connect")
+		return nil, errNotWebsocket
 	}
-	if conn, err := upgrader.Upgrade(w, r, nil); err != nil {
+	if conn, err := i.upgrader.Upgrade(w, r, nil); err != nil {
 		return nil, errors.New("[websocket server] upgrade websocket failure:" + err.Error())
 	} else {
 		return conn, nil
@@ -146,6 +319,9 @@ func (i *wsInstance) Transport(conn *play.Conn, data []byte) (err error) {
 	if conn.Websocket.MessageType == 0 {
 		conn.Websocket.MessageType = websocket.TextMessage
 	}
+	if i.writeTimeout > 0 {
+		conn.Websocket.WebsocketConn.SetWriteDeadline(time.Now().Add(i.writeTimeout))
+	}
 	err = conn.Websocket.WebsocketConn.WriteMessage(conn.Websocket.MessageType, data)
 	return err
 }
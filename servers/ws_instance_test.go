@@ -0,0 +1,54 @@
+package servers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWsInstanceReplyMessageType(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+	}{
+		{name: "sequential"},
+		{name: "concurrent", concurrency: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := NewWsInstance("ws", "", nil, nil, 0).WithConcurrency(tt.concurrency)
+			if err := i.BindActionSpace("", "servertest"); err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(i)
+			defer srv.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/hello", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			// 握手时的响应为文本消息, 之后按每条请求消息的类型回复
+			if messageType, data, err := conn.ReadMessage(); err != nil || messageType != websocket.TextMessage || !strings.Contains(string(data), `"msg":"hello play"`) {
+				t.Fatalf("handshake reply: type = %d, data = %s, err = %v", messageType, data, err)
+			}
+			for _, messageType := range []int{websocket.BinaryMessage, websocket.TextMessage, websocket.BinaryMessage} {
+				if err = conn.WriteMessage(messageType, []byte(`{"name":"ws"}`)); err != nil {
+					t.Fatal(err)
+				}
+				got, data, err := conn.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != messageType || !strings.Contains(string(data), `"msg":"hello ws"`) {
+					t.Fatalf("reply: type = %d, want %d, data = %s", got, messageType, data)
+				}
+			}
+		})
+	}
+}
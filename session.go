@@ -2,34 +2,61 @@ package play
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/google/uuid"
 )
 
+// ErrClientClosed 客户端断开连接时 action Context 的取消原因, errors.Is(err, context.Canceled) 同样成立
+var ErrClientClosed = fmt.Errorf("client closed connection: %w", context.Canceled)
+
+// ErrRequestCanceled 请求方取消单个请求(如 pproto v5 的取消帧)时 action Context 的取消原因
+var ErrRequestCanceled = fmt.Errorf("request canceled by client: %w", context.Canceled)
+
 type Session struct {
 	SessId    string
 	User      interface{}
 	Conn      *Conn
 	Server    IServer
 	ctx       context.Context
-	ctxCancel context.CancelFunc
+	ctxCancel context.CancelCauseFunc
+	writeMu   sync.Mutex
 }
 
+// NewSession 会话继承 cxt 中的值, cxt 被取消(如HTTP客户端断开)时会话以 ErrClientClosed 取消
 func NewSession(cxt context.Context, server IServer) *Session {
 	sess := &Session{
 		Conn:   &Conn{Type: server.Info().ServerType()},
 		SessId: uuid.New().String(),
 		Server: server,
 	}
-	sess.ctx, sess.ctxCancel = context.WithCancel(cxt)
+	sess.ctx, sess.ctxCancel = context.WithCancelCause(context.WithoutCancel(cxt))
+	if cxt.Done() != nil {
+		context.AfterFunc(cxt, func() {
+			if cause := context.Cause(cxt); errors.Is(cause, context.DeadlineExceeded) {
+				sess.ctxCancel(cause)
+			} else {
+				sess.ctxCancel(ErrClientClosed)
+			}
+		})
+	}
 	return sess
 }
 
+// Write 输出响应, 同一连接上并发处理的请求串行写出
 func (s *Session) Write(res *Response) (err error) {
 	if res != nil {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
 		var data []byte
-		if data, err = s.Server.Packer().Pack(s.Conn, res); err == nil && len(data) > 0 {
-			err = s.Server.Transport(s.Conn, data)
+		var conn = s.Conn
+		if res.conn != nil {
+			conn = res.conn
+		}
+		if data, err = s.Server.Packer().Pack(conn, res); err == nil && len(data) > 0 {
+			err = s.Server.Transport(conn, data)
 			if err == nil {
 				res.ResponseSize = len(data)
 			}
@@ -37,13 +64,35 @@ func (s *Session) Write(res *Response) (err error) {
 	}
 
 	if err != nil {
-		s.ctxCancel()
+		s.ctxCancel(err)
 	}
 	return err
 }
 
+// WriteRaw 直接写出已编码的数据, 如 SSE 的注释行, 与 Write 串行
+func (s *Session) WriteRaw(data []byte) (err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err = s.Server.Transport(s.Conn, data); err != nil {
+		s.ctxCancel(err)
+	}
+	return err
+}
+
+// UpdateConn 在写锁内修改连接状态, 读取协程据此更新 Pack 依赖的协议版本等, 避免与并发写出的响应竞争
+func (s *Session) UpdateConn(update func(c *Conn)) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	update(s.Conn)
+}
+
 func (s *Session) Close() {
-	s.ctxCancel()
+	s.ctxCancel(nil)
+}
+
+// CloseWithCause 以指定原因关闭会话, 进行中的action可通过 ctx.Err() 获取该原因
+func (s *Session) CloseWithCause(cause error) {
+	s.ctxCancel(cause)
 }
 
 func (s *Session) Context() context.Context {
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package play
+
+import "net"
+
+// checkConnAlive 非 unix 平台无法非阻塞窥探连接, 不做检查, 可通过 WithHealthCheck 自定义
+func checkConnAlive(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package play
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// checkConnAlive 非阻塞地窥探空闲连接: 无数据可读说明连接正常, 读到 EOF 或数据说明已不可用
+func checkConnAlive(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	var rerr error
+	var b [1]byte
+	if err = rc.Read(func(fd uintptr) bool {
+		n, _, rerr = syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		return true
+	}); err != nil {
+		return err
+	}
+	switch {
+	case rerr == syscall.EAGAIN:
+		return nil
+	case rerr != nil:
+		return rerr
+	case n == 0:
+		return io.EOF
+	default:
+		return errors.New("unexpected data on idle connection")
+	}
+}
@@ -1,54 +1,143 @@
 package play
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net"
+	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	ErrPoolTimeout = errors.New("socket pool wait connection timeout")
+	ErrPoolClosed  = errors.New("socket pool is closed")
+)
+
 type GroupSocket struct {
-	mu      sync.Mutex
-	groups  map[string]*socketWeightPool
-	maxIdle int // 连接池中每台服务器最大空闲连接数
-	// maxConn     int           // 连接池中每台服务器最多连接数 0：表示不限制
-	// maxWaitTime time.Duration //获取连接最大等待时间 0：表示不限制
-	hosts map[string]map[string]int
+	mu          sync.Mutex
+	groups      map[string]*socketWeightPool
+	maxIdle     int           // 连接池中每台服务器最大空闲连接数
+	maxConn     int           // 连接池中每台服务器最多连接数 0：表示不限制
+	maxWaitTime time.Duration // 达到 maxConn 时获取连接最大等待时间 0：表示不限制
+	dialTimeout time.Duration
+	idleTimeout time.Duration // 空闲超过该时长的连接被淘汰 0：表示不淘汰
+	healthCheck func(conn net.Conn) error
+	maxFails    int           // 连续失败达到该次数的服务器被摘除 0：表示不摘除
+	ejectTime   time.Duration // 摘除时长, 到期后在相同时长内逐步恢复权重
+	newBalancer func() Balancer
+	hosts       map[string]map[string]int
+}
+
+// SocketStats 单台服务器的连接池统计
+type SocketStats struct {
+	Weight    int
+	Active    int   // 借出中的连接数
+	Idle      int   // 空闲连接数
+	Waiting   int   // 等待连接的请求数
+	Dials     int64 // 累计新建连接数
+	DialFails int64
+	Timeouts  int64 // 等待连接超时次数
+	Evicted   int64 // 因空闲超时或检查失败淘汰的连接数
+	Ejections int64 // 累计被摘除次数
+	Ejected   bool  // 当前是否处于摘除状态
 }
 
 type socketWeightPool struct {
 	mu            sync.Mutex
 	hostsWeighted map[string]*weighted
+	balancer      Balancer
 }
 
 type weighted struct {
-	host                  string
-	weight, currentWeight int
-	connChans             chan *SocketConn
+	gs        *GroupSocket
+	host      string
+	weight    int
+	bh        *BalanceHost // 参与负载均衡, Weight 为摘除恢复期间的有效权重, 借出的连接计入处理中请求
+	connChans chan *SocketConn
+	slots     chan struct{} // 持有的连接数, nil 表示不限制
+	closed    atomic.Bool
+	done      chan struct{} // 关闭时 close, 唤醒等待连接的请求
+
+	mu           sync.Mutex
+	fails        int
+	ejectedUntil time.Time
+
+	waiting                             atomic.Int64
+	dials, dialFails, timeouts, evicted atomic.Int64
+	ejections                           atomic.Int64
 }
 
 type SocketConn struct {
 	net.Conn
-	w    *weighted
-	dead bool
+	w        *weighted
+	dead     bool
+	released bool
+	idleAt   time.Time
 }
 
-func newWeightPool(hosts map[string]int, maxIdle int) *socketWeightPool {
-	weightPool := &socketWeightPool{hostsWeighted: make(map[string]*weighted, len(hosts))}
+func (gs *GroupSocket) newWeightPool(hosts map[string]int) *socketWeightPool {
+	weightPool := &socketWeightPool{hostsWeighted: make(map[string]*weighted, len(hosts)), balancer: NewRoundRobinBalancer()}
+	if gs.newBalancer != nil {
+		weightPool.balancer = gs.newBalancer()
+	}
 	for k, v := range hosts {
-		weightPool.hostsWeighted[k] = &weighted{
-			host:      k,
-			weight:    v,
-			connChans: make(chan *SocketConn, maxIdle),
-		}
+		weightPool.hostsWeighted[k] = gs.newWeighted(k, v)
 	}
 
 	return weightPool
 }
 
+func (gs *GroupSocket) newWeighted(host string, weight int) *weighted {
+	w := &weighted{gs: gs, host: host, weight: weight, bh: &BalanceHost{Host: host, Weight: weight}, connChans: make(chan *SocketConn, gs.maxIdle), done: make(chan struct{})}
+	if gs.maxConn > 0 {
+		w.slots = make(chan struct{}, gs.maxConn)
+	}
+	return w
+}
+
 func NewGroupSocket(maxIdle int) *GroupSocket {
-	return &GroupSocket{groups: make(map[string]*socketWeightPool, 1), maxIdle: maxIdle, hosts: make(map[string]map[string]int, 1)}
+	return &GroupSocket{groups: make(map[string]*socketWeightPool, 1), maxIdle: maxIdle, dialTimeout: 50 * time.Millisecond, hosts: make(map[string]map[string]int, 1)}
+}
+
+// WithMaxConn 限制每台服务器的连接数, 达到上限时最多等待 maxWaitTime, 0 表示一直等待直到 ctx 取消或服务器被删除
+// With 系列设置需在 SetGroup/SetHost 之前调用
+func (gs *GroupSocket) WithMaxConn(maxConn int, maxWaitTime time.Duration) *GroupSocket {
+	gs.maxConn, gs.maxWaitTime = maxConn, maxWaitTime
+	return gs
+}
+
+// WithDialTimeout 设置建立连接的超时时间, 默认50ms
+func (gs *GroupSocket) WithDialTimeout(timeout time.Duration) *GroupSocket {
+	gs.dialTimeout = timeout
+	return gs
+}
+
+// WithIdleTimeout 空闲超过 timeout 的连接在取出时关闭
+func (gs *GroupSocket) WithIdleTimeout(timeout time.Duration) *GroupSocket {
+	gs.idleTimeout = timeout
+	return gs
+}
+
+// WithHealthCheck 取出空闲连接时的检查, 返回错误的连接被关闭; 未设置时检查对端是否已关闭连接
+func (gs *GroupSocket) WithHealthCheck(check func(conn net.Conn) error) *GroupSocket {
+	gs.healthCheck = check
+	return gs
+}
+
+// WithEjection 连续 maxFails 次建连失败或连接被 SetDead 的服务器摘除 ejectTime,
+// 之后在 ejectTime 内按比例恢复权重; 全部服务器被摘除时忽略摘除状态
+func (gs *GroupSocket) WithEjection(maxFails int, ejectTime time.Duration) *GroupSocket {
+	gs.maxFails, gs.ejectTime = maxFails, ejectTime
+	return gs
+}
+
+// WithBalancer 设置各分组的负载均衡策略, 默认平滑加权轮询; 每个分组调用一次 newBalancer 创建独立的实例
+func (gs *GroupSocket) WithBalancer(newBalancer func() Balancer) *GroupSocket {
+	gs.newBalancer = newBalancer
+	return gs
 }
 
 func (gs *GroupSocket) SetGroup(groupName string, hosts map[string]int) {
@@ -61,7 +150,7 @@ func (gs *GroupSocket) SetGroup(groupName string, hosts map[string]int) {
 		}
 	}
 
-	gs.groups[groupName] = newWeightPool(hosts, gs.maxIdle)
+	gs.groups[groupName] = gs.newWeightPool(hosts)
 	gs.hosts[groupName] = hosts
 }
 
@@ -71,18 +160,35 @@ func (gs *GroupSocket) SetHost(groupName, host string, weight int) {
 
 	if ghost, ok := gs.hosts[groupName]; !ok {
 		gs.hosts[groupName] = map[string]int{host: weight}
-		gs.groups[groupName] = newWeightPool(map[string]int{host: weight}, gs.maxIdle)
+		gs.groups[groupName] = gs.newWeightPool(map[string]int{host: weight})
 	} else {
+		pool := gs.groups[groupName]
+		pool.mu.Lock()
 		if _, ok := ghost[host]; !ok {
-			gs.groups[groupName].hostsWeighted[host] = &weighted{host: host, weight: weight, connChans: make(chan *SocketConn, gs.maxIdle)}
+			pool.hostsWeighted[host] = gs.newWeighted(host, weight)
 		} else {
-			gs.groups[groupName].hostsWeighted[host].weight = weight
+			pool.hostsWeighted[host].weight = weight
 		}
+		pool.mu.Unlock()
 
 		ghost[host] = weight
 	}
 }
 
+// SetHostTag 设置服务器的 tag, 配合 NewTagBalancer 按请求的 TagId 路由
+func (gs *GroupSocket) SetHostTag(groupName, host string, tagId int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if pool, ok := gs.groups[groupName]; ok {
+		pool.mu.Lock()
+		if w := pool.hostsWeighted[host]; w != nil {
+			w.bh.TagId = tagId
+		}
+		pool.mu.Unlock()
+	}
+}
+
 func (gs *GroupSocket) Delete(groupName, host string) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -98,8 +204,11 @@ func (gs *GroupSocket) Delete(groupName, host string) {
 			}
 		} else {
 			if _, ok := ghost[host]; ok {
+				pools.mu.Lock()
 				w := pools.hostsWeighted[host]
 				delete(pools.hostsWeighted, host)
+				removeBalanceHost(pools.balancer, w.bh)
+				pools.mu.Unlock()
 				delete(ghost, host)
 				w.close()
 				if len(ghost) == 0 {
@@ -111,67 +220,239 @@ func (gs *GroupSocket) Delete(groupName, host string) {
 	}
 }
 
+// GetHosts 返回分组与服务器权重的副本
 func (gs *GroupSocket) GetHosts() map[string]map[string]int {
-	return gs.hosts
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	var hosts = make(map[string]map[string]int, len(gs.hosts))
+	for group, ghost := range gs.hosts {
+		hosts[group] = make(map[string]int, len(ghost))
+		for host, weight := range ghost {
+			hosts[group][host] = weight
+		}
+	}
+	return hosts
 }
 
-func (gs *GroupSocket) GetSocketConnByGroupName(groupName string) (*SocketConn, error) {
-	var ok bool
-	var pool *socketWeightPool
-	if pool, ok = gs.groups[groupName]; !ok {
-		gs.mu.Lock()
-		if pool, ok = gs.groups[groupName]; !ok {
-			gs.groups[groupName] = newWeightPool(gs.hosts[groupName], gs.maxIdle)
-			pool = gs.groups[groupName]
+// Stats 返回各分组下每台服务器的连接池统计
+func (gs *GroupSocket) Stats() map[string]map[string]SocketStats {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	var now = time.Now()
+	var stats = make(map[string]map[string]SocketStats, len(gs.groups))
+	for name, pool := range gs.groups {
+		pool.mu.Lock()
+		group := make(map[string]SocketStats, len(pool.hostsWeighted))
+		for host, w := range pool.hostsWeighted {
+			w.mu.Lock()
+			ejected := now.Before(w.ejectedUntil)
+			w.mu.Unlock()
+			group[host] = SocketStats{
+				Weight:    w.weight,
+				Active:    int(w.bh.Inflight()),
+				Idle:      len(w.connChans),
+				Waiting:   int(w.waiting.Load()),
+				Dials:     w.dials.Load(),
+				DialFails: w.dialFails.Load(),
+				Timeouts:  w.timeouts.Load(),
+				Evicted:   w.evicted.Load(),
+				Ejections: w.ejections.Load(),
+				Ejected:   ejected,
+			}
 		}
-		gs.mu.Unlock()
+		pool.mu.Unlock()
+		stats[name] = group
+	}
+	return stats
+}
+
+func (gs *GroupSocket) GetSocketConnByGroupName(groupName string) (*SocketConn, error) {
+	return gs.GetSocketConn(context.Background(), groupName)
+}
+
+// GetSocketConn 按 ctx 中的路由依据(见 BalanceKeyOf)选择服务器并取出连接, 等待连接时 ctx 取消则返回 ctx.Err()
+func (gs *GroupSocket) GetSocketConn(ctx context.Context, groupName string) (*SocketConn, error) {
+	gs.mu.Lock()
+	pool, ok := gs.groups[groupName]
+	if !ok {
+		pool = gs.newWeightPool(gs.hosts[groupName])
+		gs.groups[groupName] = pool
 	}
-	return pool.getWeightConn()
+	gs.mu.Unlock()
+	return pool.getWeightConn(ctx)
 }
 
-func (p *socketWeightPool) getWeightConn() (*SocketConn, error) {
-	if weightedHost, err := p.next(); err != nil {
+func (p *socketWeightPool) getWeightConn(ctx context.Context) (*SocketConn, error) {
+	if weightedHost, err := p.next(ctx); err != nil {
 		return nil, err
 	} else {
-		return weightedHost.getConn()
+		return weightedHost.getConn(ctx)
 	}
 }
 
-func (p *socketWeightPool) next() (*weighted, error) {
-	var total int
-	var best *weighted
-	var err error
+func (p *socketWeightPool) next(ctx context.Context) (*weighted, error) {
+	var now = time.Now()
+	var hosts = make([]*BalanceHost, 0, len(p.hostsWeighted))
 
 	p.mu.Lock()
-	for _, v := range p.hostsWeighted {
-		total += v.weight
-		v.currentWeight += v.weight
-		if best == nil || v.currentWeight > best.currentWeight {
-			best = v
+	defer p.mu.Unlock()
+	for _, ignoreEject := range []bool{false, true} {
+		for _, v := range p.hostsWeighted {
+			if v.bh.Weight, v.bh.configured = v.weight, v.weight; !ignoreEject {
+				v.bh.Weight = v.effectiveWeight(now)
+			}
+			if v.bh.Weight > 0 {
+				hosts = append(hosts, v.bh)
+			}
+		}
+		if len(hosts) > 0 {
+			break
 		}
 	}
-	if best != nil {
-		best.currentWeight -= total
-	} else {
-		err = errors.New("weight pool is empty")
+	if len(hosts) == 0 {
+		return nil, errors.New("weight pool is empty")
 	}
-	p.mu.Unlock()
+	// map 遍历顺序随机, 排序后一致性哈希等策略结果稳定
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return p.hostsWeighted[pickUntried(ctx, p.balancer, hosts).Host], nil
+}
 
-	return best, err
+// effectiveWeight 摘除期间为0, 恢复期内按经过的时间比例恢复
+func (w *weighted) effectiveWeight(now time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ejectedUntil.IsZero() {
+		return w.weight
+	}
+	if now.Before(w.ejectedUntil) {
+		return 0
+	}
+	if elapsed := now.Sub(w.ejectedUntil); elapsed < w.gs.ejectTime {
+		return max(1, int(int64(w.weight)*int64(elapsed)/int64(w.gs.ejectTime)))
+	}
+	w.ejectedUntil = time.Time{}
+	return w.weight
 }
 
-func (w *weighted) getConn() (*SocketConn, error) {
-	select {
-	case conn := <-w.connChans:
-		return conn, nil
-	default:
-		nconn, err := net.DialTimeout("tcp", w.host, 50*time.Millisecond)
-		if err != nil {
-			return nil, err
+func (w *weighted) getConn(ctx context.Context) (*SocketConn, error) {
+	var timeout <-chan time.Time
+	for {
+		if w.closed.Load() {
+			return nil, ErrPoolClosed
+		}
+		select {
+		case conn := <-w.connChans:
+			if w.checkIdle(conn) {
+				return w.borrow(conn), nil
+			}
+			continue
+		default:
 		}
-		fmt.Println("new connect", w.host)
-		return &SocketConn{Conn: nconn, w: w}, nil
+
+		if w.slots == nil {
+			return w.dial()
+		}
+		select {
+		case w.slots <- struct{}{}:
+			return w.dial()
+		default:
+		}
+
+		// 连接数已达上限, 等待归还的空闲连接或被关闭连接释放的名额
+		if timeout == nil && w.gs.maxWaitTime > 0 {
+			timer := time.NewTimer(w.gs.maxWaitTime)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		w.waiting.Add(1)
+		select {
+		case conn := <-w.connChans:
+			w.waiting.Add(-1)
+			if w.checkIdle(conn) {
+				return w.borrow(conn), nil
+			}
+		case w.slots <- struct{}{}:
+			w.waiting.Add(-1)
+			return w.dial()
+		case <-timeout:
+			w.waiting.Add(-1)
+			w.timeouts.Add(1)
+			return nil, ErrPoolTimeout
+		case <-ctx.Done():
+			w.waiting.Add(-1)
+			return nil, ctx.Err()
+		case <-w.done:
+			w.waiting.Add(-1)
+			return nil, ErrPoolClosed
+		}
+	}
+}
+
+// dial 调用前已占用一个连接名额, 失败时释放
+func (w *weighted) dial() (*SocketConn, error) {
+	nconn, err := net.DialTimeout("tcp", w.host, w.gs.dialTimeout)
+	if err != nil {
+		w.release()
+		w.dialFails.Add(1)
+		w.markFail()
+		return nil, err
+	}
+	w.dials.Add(1)
+	return w.borrow(&SocketConn{Conn: nconn, w: w}), nil
+}
+
+func (w *weighted) borrow(conn *SocketConn) *SocketConn {
+	conn.released = false
+	w.bh.Acquire()
+	return conn
+}
+
+func (w *weighted) release() {
+	if w.slots != nil {
+		<-w.slots
+	}
+}
+
+// checkIdle 检查取出的空闲连接是否可用, 不可用时关闭
+func (w *weighted) checkIdle(conn *SocketConn) bool {
+	var err error
+	if w.gs.idleTimeout > 0 && time.Since(conn.idleAt) > w.gs.idleTimeout {
+		err = os.ErrDeadlineExceeded
+	} else if w.gs.healthCheck != nil {
+		err = w.gs.healthCheck(conn.Conn)
+	} else {
+		err = checkConnAlive(conn.Conn)
+	}
+	if err != nil {
+		w.evicted.Add(1)
+		w.discard(conn)
+		return false
+	}
+	return true
+}
+
+func (w *weighted) markFail() {
+	if w.gs.maxFails <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fails++; w.fails >= w.gs.maxFails {
+		w.fails = 0
+		w.ejectedUntil = time.Now().Add(w.gs.ejectTime)
+		w.ejections.Add(1)
+	}
+}
+
+func (w *weighted) markSuccess() {
+	if w.gs.maxFails <= 0 {
+		return
 	}
+	w.mu.Lock()
+	w.fails = 0
+	w.mu.Unlock()
 }
 
 func (w *weighted) putConn(conn *SocketConn) error {
@@ -179,43 +460,59 @@ func (w *weighted) putConn(conn *SocketConn) error {
 		return errors.New("connection is nil")
 	}
 
-	if w.connChans == nil {
-		conn.Conn.Close()
+	if w.closed.Load() {
+		return w.discard(conn)
 	}
 
+	conn.idleAt = time.Now()
 	select {
 	case w.connChans <- conn:
 		return nil
 	default:
-		return conn.Conn.Close()
+		return w.discard(conn)
 	}
 }
 
+func (w *weighted) discard(conn *SocketConn) error {
+	err := conn.Conn.Close()
+	w.release()
+	return err
+}
+
 func (w *weighted) close() {
-	chans := w.connChans
-	w.connChans = nil
-
-	go func() {
-		for conn := range chans {
-			if conn != nil {
-				conn.dead = true
-				conn.Conn.Close()
-			}
+	if w.closed.CompareAndSwap(false, true) {
+		close(w.done)
+	}
+	for {
+		select {
+		case conn := <-w.connChans:
+			conn.dead = true
+			w.discard(conn)
+		default:
+			return
 		}
-	}()
+	}
 }
 
 func (conn *SocketConn) SetDead() {
 	conn.dead = true
 }
 
+// Close 归还连接, 被 SetDead 的连接直接关闭并计入服务器失败次数
 func (conn *SocketConn) Close() error {
+	if conn.released {
+		return nil
+	}
+	conn.released = true
+	conn.w.bh.Release()
 	if conn.dead {
+		conn.w.markFail()
 		if conn.Conn != nil {
-			fmt.Println(conn.Conn.Close())
-			return nil
+			return conn.w.discard(conn)
 		}
+		conn.w.release()
 		return nil
 	}
+	conn.w.markSuccess()
 	return conn.w.putConn(conn)
 }